@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sessionsCmd outputs the current login sessions.  loginctl is preferred as
+// it includes sessions without a tty, but isn't available on hosts without
+// systemd.  The first line identifies which command produced the output.
+const sessionsCmd = "sh -c 'if loginctl list-sessions --no-legend >/dev/null 2>&1; then echo loginctl; loginctl list-sessions --no-legend; else echo who; who; fi'"
+
+// processesCmd outputs the UID of every running process.  -A is used rather
+// than -e as BSD ps interprets the latter as a request for the environment.
+const processesCmd = "ps -A -o uid="
+
+// parseSessions counts the current login sessions of each known user on a
+// host.  The output of "loginctl list-sessions" has the user in the third
+// column whilst "who" has it in the first.
+func (h *hostsInfo) parseSessions(hostName string, b bytes.Buffer) {
+	lines := strings.Split(b.String(), "\n")
+	userField := 0
+	if strings.TrimSpace(lines[0]) == "loginctl" {
+		userField = 2
+	}
+	counts := make(map[string]int)
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) > userField {
+			counts[fields[userField]]++
+		}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for userName, u := range h.users[hostName] {
+		u.sessions = counts[userName]
+		h.users[hostName][userName] = u
+	}
+}
+
+// parseProcesses counts the running processes owned by each known user on a
+// host.
+func (h *hostsInfo) parseProcesses(hostName string, b bytes.Buffer) {
+	counts := make(map[int]int)
+	for _, line := range strings.Split(b.String(), "\n") {
+		if uid, err := strconv.Atoi(strings.TrimSpace(line)); err == nil {
+			counts[uid]++
+		}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for userName, u := range h.users[hostName] {
+		u.processes = counts[u.uid]
+		h.users[hostName][userName] = u
+	}
+}
+
+// staleActive returns true if a human account hasn't logged in for staleDays
+// (or has never logged in) but is currently running processes.  System
+// accounts are expected to run processes without logging in so they're never
+// considered stale.  Without the host's login history, nothing is stale.
+func (u *userInfo) staleActive(now time.Time, staleDays int) bool {
+	if u.class != classHuman || u.processes <= 0 || !u.loginsKnown {
+		return false
+	}
+	return u.lastLoginDate.Before(now.AddDate(0, 0, -staleDays))
+}
+
+// activityColumns returns the session and process counts, along with the
+// stale-active flag, formatted for CSV.  Counts that weren't collected, and
+// the flag when login history wasn't, produce empty columns.
+func (u *userInfo) activityColumns(now time.Time, staleDays int) string {
+	var sessions, processes, stale string
+	if u.sessions >= 0 {
+		sessions = strconv.Itoa(u.sessions)
+	}
+	if u.processes >= 0 {
+		processes = strconv.Itoa(u.processes)
+	}
+	if u.loginsKnown {
+		stale = strconv.FormatBool(u.staleActive(now, staleDays))
+	}
+	return strings.Join([]string{sessions, processes, stale}, ",")
+}
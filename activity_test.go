@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestActivity(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	hosts := newHosts()
+	passwd := bytes.NewBufferString(`root:x:0:0:root:/root:/bin/bash
+alice:x:1000:1000:Alice:/home/alice:/bin/bash
+bob:x:1001:1001:Bob:/home/bob:/bin/bash
+carol:x:1002:1002:Carol:/home/carol:/bin/bash
+`)
+	hosts.parsePasswd("host01", "files", *passwd)
+	alice := hosts.users["host01"]["alice"]
+	if c := alice.activityColumns(now, 90); c != ",," {
+		t.Errorf("Unexpected columns before collection: %s", c)
+	}
+	hosts.parseSessions("host01", *bytes.NewBufferString(`loginctl
+      3 1000 alice seat0 tty2
+     17 1000 alice       pts/1
+     21    0 root        pts/2
+`))
+	hosts.parseProcesses("host01", *bytes.NewBufferString("    0\n    0\n 1000\n 1001\n 1001\n 1001\n"))
+	// Alice logged in recently, Bob hasn't logged in for a year and Carol has
+	// never logged in but has no processes.
+	for name, last := range map[string]time.Time{"alice": now.AddDate(0, 0, -1), "bob": now.AddDate(-1, 0, 0)} {
+		u := hosts.users["host01"][name]
+		u.setLast(last, "")
+		hosts.users["host01"][name] = u
+	}
+	// Without login history, nobody is stale
+	bob := hosts.users["host01"]["bob"]
+	if c := bob.activityColumns(now, 90); c != "0,3," {
+		t.Errorf("Unexpected columns without login history: %s", c)
+	}
+	hosts.setLoginsKnown("host01")
+	var tests = []struct {
+		user     string
+		expected string
+	}{
+		{"root", "1,2,false"},
+		{"alice", "2,1,false"},
+		{"bob", "0,3,true"},
+		{"carol", "0,0,false"},
+	}
+	for _, tt := range tests {
+		u := hosts.users["host01"][tt.user]
+		if c := u.activityColumns(now, 90); c != tt.expected {
+			t.Errorf("%s: Unexpected columns: Wanted=%s, Got=%s", tt.user, tt.expected, c)
+		}
+	}
+
+	// The output of who has the user in the first column
+	hosts.parseSessions("host01", *bytes.NewBufferString("who\nbob      pts/0        2024-05-31 10:00 (10.0.0.5)\n"))
+	if n := hosts.users["host01"]["bob"].sessions; n != 1 {
+		t.Errorf("Unexpected who sessions: Wanted=1, Got=%d", n)
+	}
+}
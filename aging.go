@@ -0,0 +1,111 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// noMaxAge is the conventional maxAge value meaning passwords never expire.
+const noMaxAge = 99999
+
+// shadowAging contains the password aging fields of /etc/shadow.  Dates are
+// expressed as days since the Epoch and durations in days.  Empty fields are
+// recorded as -1.
+type shadowAging struct {
+	lastChange int
+	minAge     int
+	maxAge     int
+	warnPeriod int
+	inactive   int
+	expire     int
+	// pwExpire is the date the password expires, used by BSD systems in
+	// place of lastChange and maxAge.
+	pwExpire int
+}
+
+// accountState contains the states derived from a user's shadow entry.
+type accountState struct {
+	locked          bool // The password is prefixed with "!"
+	expired         bool // The account expiry date has passed
+	passwordExpired bool // The password has exceeded its maximum age
+	inactive        bool // The inactivity period after password expiry has passed
+	neverExpires    bool // The password has no maximum age
+}
+
+// atoiDefault converts s to an integer.  Empty or invalid strings return -1.
+func atoiDefault(s string) int {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// parseAging extracts the aging fields from the fields of a shadow line.
+// Missing trailing fields are treated as empty.
+func parseAging(fields []string) shadowAging {
+	field := func(n int) int {
+		if n >= len(fields) {
+			return -1
+		}
+		return atoiDefault(fields[n])
+	}
+	return shadowAging{
+		lastChange: field(2),
+		minAge:     field(3),
+		maxAge:     field(4),
+		warnPeriod: field(5),
+		inactive:   field(6),
+		expire:     field(7),
+		pwExpire:   -1,
+	}
+}
+
+// epochDays returns the number of whole days between the Epoch and t.
+func epochDays(t time.Time) int {
+	return int(t.Unix() / (3600 * 24))
+}
+
+// states derives the account states at the given time.
+func (a shadowAging) states(now time.Time, locked bool) accountState {
+	today := epochDays(now)
+	s := accountState{
+		locked:       locked,
+		expired:      a.expire >= 0 && a.expire <= today,
+		neverExpires: (a.maxAge < 0 || a.maxAge >= noMaxAge) && a.pwExpire < 0,
+	}
+	// A lastChange of zero means the user must change their password at next
+	// login.
+	if a.pwExpire >= 0 {
+		s.passwordExpired = a.pwExpire <= today
+	} else if a.lastChange == 0 {
+		s.passwordExpired = true
+	} else if a.lastChange > 0 && !s.neverExpires {
+		pwExpiry := a.lastChange + a.maxAge
+		s.passwordExpired = pwExpiry < today
+		s.inactive = a.inactive >= 0 && pwExpiry+a.inactive < today
+	}
+	return s
+}
+
+// columns returns the aging fields and derived states as CSV columns.
+func (a shadowAging) columns(now time.Time, locked bool) string {
+	days := func(n int) string {
+		if n < 0 {
+			return ""
+		}
+		return strconv.Itoa(n)
+	}
+	var expire string
+	if a.expire >= 0 {
+		expire = time.Unix(int64(a.expire)*3600*24, 0).UTC().Format("2006-01-02")
+	}
+	s := a.states(now, locked)
+	return strings.Join([]string{
+		days(a.minAge), days(a.maxAge), days(a.warnPeriod), days(a.inactive), expire,
+		strconv.FormatBool(s.locked), strconv.FormatBool(s.expired),
+		strconv.FormatBool(s.passwordExpired), strconv.FormatBool(s.inactive),
+		strconv.FormatBool(s.neverExpires),
+	}, ",")
+}
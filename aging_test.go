@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccountStates(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	today := epochDays(now)
+	var tests = []struct {
+		line     string
+		locked   bool
+		expected accountState
+	}{
+		// No aging at all
+		{"a:$6$x::::::", false, accountState{neverExpires: true}},
+		// Locked with a conventional never-expires max
+		{"b:!$6$x:19000:0:99999:7:::", true, accountState{locked: true, neverExpires: true}},
+		// Password changed 100 days ago with a 90 day maximum
+		{"c:$6$x:" + strconv.Itoa(today-100) + ":0:90:7:::", false, accountState{passwordExpired: true}},
+		// As above but the 5 day inactivity period has also passed
+		{"d:$6$x:" + strconv.Itoa(today-100) + ":0:90:7:5::", false, accountState{passwordExpired: true, inactive: true}},
+		// As above but the inactivity period has yet to pass
+		{"e:$6$x:" + strconv.Itoa(today-100) + ":0:90:7:30::", false, accountState{passwordExpired: true}},
+		// Forced password change at next login
+		{"f:$6$x:0:0:99999:7:::", false, accountState{passwordExpired: true, neverExpires: true}},
+		// Account expired yesterday
+		{"g:$6$x:" + strconv.Itoa(today) + ":0:90:7::" + strconv.Itoa(today-1) + ":", false, accountState{expired: true}},
+	}
+	for _, tt := range tests {
+		fields := strings.Split(tt.line, ":")
+		s := parseAging(fields).states(now, tt.locked)
+		if s != tt.expected {
+			t.Errorf("%s: Unexpected states: Wanted=%+v, Got=%+v", fields[0], tt.expected, s)
+		}
+	}
+}
+
+func TestAgingColumns(t *testing.T) {
+	a := parseAging(strings.Split("a:$6$x:19000:1:90:7:14:19900:", ":"))
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	expected := "1,90,7,14,2024-06-26,false,false,true,true,false"
+	if c := a.columns(now, false); c != expected {
+		t.Errorf("Unexpected columns: Wanted=%s, Got=%s", expected, c)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stanza is a named block of attributes, as used by AIX configuration files
+// and the "-f" output of commands such as lsuser.
+type stanza struct {
+	name  string
+	attrs map[string]string
+}
+
+// parseStanzas parses AIX stanza formatted content.  Each stanza starts with
+// an unindented "name:" line, followed by indented "attribute = value" lines.
+// Lines beginning with an asterisk are comments.
+func parseStanzas(b bytes.Buffer) []stanza {
+	var stanzas []stanza
+	for _, line := range strings.Split(b.String(), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "*") {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' && strings.HasSuffix(trimmed, ":") {
+			stanzas = append(stanzas, stanza{
+				name:  strings.TrimSuffix(trimmed, ":"),
+				attrs: make(map[string]string),
+			})
+			continue
+		}
+		kv := strings.SplitN(trimmed, "=", 2)
+		if len(kv) != 2 || len(stanzas) == 0 {
+			continue
+		}
+		stanzas[len(stanzas)-1].attrs[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return stanzas
+}
+
+// weeksToDays converts an AIX age in weeks to days.  A value of zero (or
+// less) means no restriction, which is recorded as -1 as for an empty shadow
+// field.
+func weeksToDays(s string) int {
+	n := atoiDefault(s)
+	if n <= 0 {
+		return -1
+	}
+	return n * 7
+}
+
+// aixExpires converts an AIX "expires" attribute (MMDDhhmmyy) to days since
+// the Epoch.  Zero means the account never expires and returns -1.
+func aixExpires(s string) int {
+	t, err := time.Parse("0102150406", s)
+	if err != nil {
+		return -1
+	}
+	return epochDays(t)
+}
+
+// parseSecurityPasswd extracts the password hash and the time it was last
+// changed from the content of /etc/security/passwd.  The ADMCHG flag forces
+// a password change at next login, which is equivalent to a zero lastchg
+// field in a Linux shadow file.
+func (h *hostsInfo) parseSecurityPasswd(hostName string, b bytes.Buffer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, s := range parseStanzas(b) {
+		u, exists := h.users[hostName][s.name]
+		if !exists {
+			continue
+		}
+		u.hash, u.hashStrength, u.locked = classifyHash(s.attrs["password"])
+		if secs, err := strconv.ParseInt(s.attrs["lastupdate"], 10, 64); err == nil {
+			u.passwdChangeDate = time.Unix(secs, 0)
+			u.aging.lastChange = epochDays(u.passwdChangeDate)
+		}
+		if strings.Contains(s.attrs["flags"], "ADMCHG") {
+			u.aging.lastChange = 0
+		}
+		h.users[hostName][s.name] = u
+	}
+}
+
+// parseLsuser extracts the password aging and account lock attributes from
+// the output of "lsuser -f ALL".  It must be called after
+// parseSecurityPasswd as a locked account overrides the state of the hash.
+func (h *hostsInfo) parseLsuser(hostName string, b bytes.Buffer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, s := range parseStanzas(b) {
+		u, exists := h.users[hostName][s.name]
+		if !exists {
+			continue
+		}
+		u.aging.minAge = weeksToDays(s.attrs["minage"])
+		u.aging.maxAge = weeksToDays(s.attrs["maxage"])
+		u.aging.warnPeriod = atoiDefault(s.attrs["pwdwarntime"])
+		if u.aging.warnPeriod == 0 {
+			u.aging.warnPeriod = -1
+		}
+		u.aging.inactive = weeksToDays(s.attrs["maxexpired"])
+		u.aging.expire = aixExpires(s.attrs["expires"])
+		if s.attrs["account_locked"] == "true" {
+			u.locked = true
+		}
+		h.users[hostName][s.name] = u
+	}
+}
+
+// parseAIXLastlog extracts the last login and the number of failed logins
+// since then from the content of /etc/security/lastlog.
+func (h *hostsInfo) parseAIXLastlog(hostName string, b bytes.Buffer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// Users without a stanza have never had a failed login.
+	for userName, u := range h.users[hostName] {
+		u.failedLogins = 0
+		h.users[hostName][userName] = u
+	}
+	for _, s := range parseStanzas(b) {
+		u, exists := h.users[hostName][s.name]
+		if !exists {
+			continue
+		}
+		if secs, err := strconv.ParseInt(s.attrs["time_last_login"], 10, 64); err == nil {
+			u.setLast(time.Unix(secs, 0), s.attrs["host_last_login"])
+		}
+		if n, err := strconv.Atoi(s.attrs["unsuccessful_login_count"]); err == nil {
+			u.failedLogins = n
+		}
+		h.users[hostName][s.name] = u
+	}
+}
+
+// aixShadow collects the AIX equivalent of the shadow file.  Password hashes
+// are held in /etc/security/passwd whilst aging and expiry are attributes
+// reported by lsuser.
+var aixShadow = &collector{
+	name:       "shadow",
+	supports:   onlyOS("AIX"),
+	privileged: true,
+	collect: func(s *hostSession, run runFunc) error {
+		b, err := run("shadow", "cat /etc/security/passwd")
+		if err != nil {
+			return err
+		}
+		s.hosts.parseSecurityPasswd(s.hostName, b)
+		b, err = run("shadow", "lsuser -f ALL")
+		if err != nil && b.Len() == 0 {
+			return fmt.Errorf("lsuser: %w", err)
+		}
+		s.hosts.parseLsuser(s.hostName, b)
+		return nil
+	},
+}
+
+// aixLast collects the login history of an AIX host from
+// /etc/security/lastlog, which is only readable by root.
+var aixLast = &collector{
+	name:       "last",
+	supports:   onlyOS("AIX"),
+	privileged: true,
+	command:    staticCommand("cat /etc/security/lastlog"),
+	parse: func(s *hostSession, b bytes.Buffer) error {
+		s.hosts.parseAIXLastlog(s.hostName, b)
+		return nil
+	},
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCollectAIX(t *testing.T) {
+	hosts := newHosts()
+	outputs := map[string]string{
+		"cat /etc/passwd": `root:!:0:0::/:/usr/bin/ksh
+alice:!:200:1:Alice:/home/alice:/usr/bin/ksh
+bob:*:201:1:Bob:/home/bob:/usr/bin/ksh
+`,
+		"cat /etc/security/passwd": `* Comment
+root:
+	password = {ssha512}06$aXayEJGxA.lFSW5H$3Aymvk8Jz5Wrb
+	lastupdate = 1700000000
+	flags =
+
+alice:
+	password = 0123456789ABC
+	lastupdate = 1710000000
+	flags = ADMCHG
+
+bob:
+	password = *
+`,
+		"lsuser -f ALL": `root:
+	id=0
+	account_locked=false
+	maxage=0
+	minage=0
+	pwdwarntime=0
+	maxexpired=-1
+	expires=0
+
+alice:
+	id=200
+	account_locked=true
+	maxage=13
+	minage=1
+	pwdwarntime=7
+	maxexpired=2
+	expires=0101000025
+`,
+		"cat /etc/security/lastlog": `alice:
+	time_last_login = 1715000000
+	tty_last_login = /dev/pts/0
+	host_last_login = 10.0.0.5
+	unsuccessful_login_count = 4
+	time_last_unsuccessful_login = 1716000000
+`,
+	}
+	messages := collectOutputs(t, hosts, "aix01", "AIX", outputs, "shadow", "last")
+	if len(messages) != 0 {
+		t.Errorf("Unexpected messages: %v", messages)
+	}
+
+	root := hosts.users["aix01"]["root"]
+	if root.hash != "ssha512" || root.locked || !root.passwdChangeDate.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("Unexpected root: hash=%s locked=%v changed=%s", root.hash, root.locked, root.passwdChangeDate)
+	}
+	if root.aging.maxAge != -1 || root.aging.expire != -1 || root.failedLogins != 0 {
+		t.Errorf("Unexpected root aging: %+v failed=%d", root.aging, root.failedLogins)
+	}
+
+	alice := hosts.users["aix01"]["alice"]
+	if alice.hash != "des" || !alice.locked || alice.aging.lastChange != 0 {
+		t.Errorf("Unexpected alice: hash=%s locked=%v lastChange=%d", alice.hash, alice.locked, alice.aging.lastChange)
+	}
+	expectedAging := shadowAging{0, 7, 91, 7, 14, epochDays(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)), -1}
+	if alice.aging != expectedAging {
+		t.Errorf("Unexpected alice aging: Wanted=%+v, Got=%+v", expectedAging, alice.aging)
+	}
+	if !alice.lastLoginDate.Equal(time.Unix(1715000000, 0)) || alice.lastLoginFrom != "10.0.0.5" || alice.failedLogins != 4 {
+		t.Errorf("Unexpected alice login: %s from %s, failed=%d", alice.lastLoginDate, alice.lastLoginFrom, alice.failedLogins)
+	}
+
+	bob := hosts.users["aix01"]["bob"]
+	if bob.hasPassword() {
+		t.Error("bob should not have a usable password")
+	}
+}
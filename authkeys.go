@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Masterminds/log-go"
+	"golang.org/x/crypto/ssh"
+)
+
+// authKey describes a single public key in a user's authorized_keys file.
+type authKey struct {
+	file        string
+	keyType     string
+	bits        int
+	fingerprint string
+	comment     string
+	options     []string
+}
+
+// weak returns true if the key type or length is considered inadequate.
+func (k authKey) weak() bool {
+	switch k.keyType {
+	case ssh.KeyAlgoDSA:
+		return true
+	case ssh.KeyAlgoRSA:
+		return k.bits < 2048
+	}
+	return false
+}
+
+// authorizedKeysFiles extracts the AuthorizedKeysFile setting from the output
+// of "sshd -T" or the content of sshd_config.  Only global settings are
+// considered, those within Match blocks are ignored.
+func authorizedKeysFiles(b bytes.Buffer) []string {
+	for _, line := range strings.Split(b.String(), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		keyword := strings.ToLower(fields[0])
+		if keyword == "match" {
+			break
+		}
+		if keyword == "authorizedkeysfile" {
+			return fields[1:]
+		}
+	}
+	// The OpenSSH default
+	return []string{".ssh/authorized_keys", ".ssh/authorized_keys2"}
+}
+
+// keysFileWord converts an AuthorizedKeysFile pattern into a shell word that
+// expands to the path for the user named in $u, whose home is $h.  Relative
+// paths are relative to the user's home directory.
+func keysFileWord(pattern string) string {
+	var word, lit strings.Builder
+	flush := func() {
+		if lit.Len() > 0 {
+			word.WriteString(shellQuote(lit.String()))
+			lit.Reset()
+		}
+	}
+	if !path.IsAbs(pattern) && !strings.HasPrefix(pattern, "%h") {
+		word.WriteString(`"$h"`)
+		lit.WriteString("/")
+	}
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] == '%' && i+1 < len(pattern) {
+			i++
+			switch pattern[i] {
+			case 'h':
+				flush()
+				word.WriteString(`"$h"`)
+			case 'u':
+				flush()
+				word.WriteString(`"$u"`)
+			default:
+				lit.WriteByte(pattern[i])
+			}
+			continue
+		}
+		lit.WriteByte(pattern[i])
+	}
+	flush()
+	return word.String()
+}
+
+// authKeysCmd returns a shell command that outputs the content of every
+// authorized_keys file for each user listed by passwdCmd.  Each file is
+// preceded by a line containing marker, the user and the filename.
+func authKeysCmd(passwdCmd, marker string, patterns []string) string {
+	var words []string
+	for _, pattern := range patterns {
+		if pattern != "none" {
+			words = append(words, keysFileWord(pattern))
+		}
+	}
+	if len(words) == 0 {
+		return "true"
+	}
+	script := fmt.Sprintf(
+		`%s | while IFS=: read -r u _ _ _ _ h _; do [ -n "$u" ] || continue; `+
+			`for p in %s; do if [ -f "$p" ]; then echo %s"$u $p"; cat "$p"; echo; fi; done; done; true`,
+		passwdCmd, strings.Join(words, " "), shellQuote(marker),
+	)
+	return "sh -c " + shellQuote(script)
+}
+
+// keyBits returns the length of a public key in bits.
+func keyBits(pub ssh.PublicKey) int {
+	cpk, ok := pub.(ssh.CryptoPublicKey)
+	if !ok {
+		return 0
+	}
+	switch k := cpk.CryptoPublicKey().(type) {
+	case *rsa.PublicKey:
+		return k.N.BitLen()
+	case *dsa.PublicKey:
+		return k.P.BitLen()
+	case *ecdsa.PublicKey:
+		return k.Curve.Params().BitSize
+	}
+	// Ed25519 and its security key variant
+	return 256
+}
+
+// parseAuthKeys parses the output of authKeysCmd, run with marker, and
+// records each key against its user.  Users listed more than once by NSS only
+// have their files recorded once.
+func (h *hostsInfo) parseAuthKeys(hostName, marker string, b bytes.Buffer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var userName, file string
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(b.String(), "\n") {
+		if strings.HasPrefix(line, marker) {
+			userName, file = "", ""
+			fields := strings.SplitN(strings.TrimPrefix(line, marker), " ", 2)
+			if len(fields) == 2 && !seen[line] {
+				seen[line] = true
+				userName, file = fields[0], fields[1]
+			}
+			continue
+		}
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || userName == "" {
+			continue
+		}
+		pub, comment, options, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			log.Debugf("%s: %s: Unable to parse key in %s: %v", hostName, userName, file, err)
+			continue
+		}
+		u, exists := h.users[hostName][userName]
+		if !exists {
+			continue
+		}
+		u.authKeys = append(u.authKeys, authKey{
+			file:        file,
+			keyType:     pub.Type(),
+			bits:        keyBits(pub),
+			fingerprint: ssh.FingerprintSHA256(pub),
+			comment:     comment,
+			options:     options,
+		})
+		h.users[hostName][userName] = u
+	}
+}
+
+// writeKeysToFile exports every authorized key for every user on every host.
+// Each key records how many distinct host/user combinations share it and
+// whether it's considered weak.
+func (h *hostsInfo) writeKeysToFile(filename string) {
+	w, done := newCSVWriter(filename, "KeysCSV")
+	defer done()
+	keys := make([]string, 0, len(h.users))
+	for k := range h.users {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	// Count the distinct host/user combinations each fingerprint is found
+	// in.  A key listed more than once for a user isn't reused.
+	reuse := make(map[string]int)
+	for _, host := range keys {
+		for _, info := range h.users[host] {
+			seen := make(map[string]bool)
+			for _, k := range info.authKeys {
+				if !seen[k.fingerprint] {
+					seen[k.fingerprint] = true
+					reuse[k.fingerprint]++
+				}
+			}
+		}
+	}
+	for _, host := range keys {
+		for _, u := range h.allUsers {
+			info, exists := h.users[host][u]
+			if !exists {
+				continue
+			}
+			for _, k := range info.authKeys {
+				w.Write([]string{
+					host, u, k.file, k.keyType, strconv.Itoa(k.bits), k.fingerprint,
+					k.comment, strings.Join(k.options, ","),
+					strconv.Itoa(reuse[k.fingerprint]), strconv.FormatBool(k.weak()),
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func authorizedKey(t *testing.T, pub interface{}) string {
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("Unable to convert key: %v", err)
+	}
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+}
+
+func TestAuthorizedKeysFiles(t *testing.T) {
+	var b bytes.Buffer
+	b.WriteString("port 22\nauthorizedkeysfile .ssh/authorized_keys /etc/ssh/keys/%u\n")
+	files := authorizedKeysFiles(b)
+	if len(files) != 2 || files[1] != "/etc/ssh/keys/%u" {
+		t.Fatalf("Unexpected AuthorizedKeysFile: %v", files)
+	}
+	if w := keysFileWord(files[0]); w != `"$h"'/.ssh/authorized_keys'` {
+		t.Errorf("Unexpected relative path: %s", w)
+	}
+	if w := keysFileWord(files[1]); w != `'/etc/ssh/keys/'"$u"` {
+		t.Errorf("Unexpected absolute path: %s", w)
+	}
+	if w := keysFileWord("%h/keys/%%%u"); w != `"$h"'/keys/%'"$u"` {
+		t.Errorf("Unexpected escaped path: %s", w)
+	}
+	b.Reset()
+	if files := authorizedKeysFiles(b); len(files) != 2 || files[0] != ".ssh/authorized_keys" {
+		t.Errorf("Unexpected default AuthorizedKeysFile: %v", files)
+	}
+}
+
+func TestParseAuthKeys(t *testing.T) {
+	edPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Unable to generate RSA key: %v", err)
+	}
+	shared := authorizedKey(t, edPub)
+	hosts := newHosts()
+	var passwd bytes.Buffer
+	passwd.WriteString("alice:x:1000:1000:Alice:/home/alice:/bin/bash\n")
+	passwd.WriteString("bob:x:1001:1001:Bob:/home/bob:/bin/bash\n")
+	hosts.parsePasswd("host01", "files", passwd)
+	marker := newMarker()
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%salice /home/alice/.ssh/authorized_keys\n", marker)
+	fmt.Fprintf(&b, "# A comment\n")
+	fmt.Fprintf(&b, "from=\"10.0.0.1,10.0.0.2\",no-pty %s alice@laptop\n", shared)
+	fmt.Fprintf(&b, "%s old-key\n", authorizedKey(t, &rsaKey.PublicKey))
+	// A user can't attribute keys to another user with a forged marker
+	fmt.Fprintf(&b, "==> bob /home/bob/.ssh/authorized_keys\n")
+	fmt.Fprintf(&b, "%s forged\n", authorizedKey(t, &rsaKey.PublicKey))
+	fmt.Fprintf(&b, "%sbob /home/bob/.ssh/authorized_keys\n", marker)
+	fmt.Fprintf(&b, "%s alice@laptop\n", shared)
+	// Users listed twice by NSS are only recorded once
+	fmt.Fprintf(&b, "%sbob /home/bob/.ssh/authorized_keys\n", marker)
+	fmt.Fprintf(&b, "%s alice@laptop\n", shared)
+	hosts.parseAuthKeys("host01", marker, b)
+
+	alice := hosts.users["host01"]["alice"]
+	if len(alice.authKeys) != 3 {
+		t.Fatalf("Unexpected key count for alice: Wanted=3, Got=%d", len(alice.authKeys))
+	}
+	if k := alice.authKeys[2]; k.comment != "forged" || k.file != "/home/alice/.ssh/authorized_keys" {
+		t.Errorf("Forged key not attributed to alice's file: %+v", k)
+	}
+	k := alice.authKeys[0]
+	if k.keyType != ssh.KeyAlgoED25519 || k.bits != 256 || k.comment != "alice@laptop" || k.weak() {
+		t.Errorf("Unexpected ed25519 key: %+v", k)
+	}
+	if len(k.options) != 2 || k.options[0] != `from="10.0.0.1,10.0.0.2"` {
+		t.Errorf("Unexpected key options: %v", k.options)
+	}
+	if k := alice.authKeys[1]; k.bits != 1024 || !k.weak() {
+		t.Errorf("RSA 1024 key not flagged as weak: %+v", k)
+	}
+	bob := hosts.users["host01"]["bob"]
+	if len(bob.authKeys) != 1 || bob.authKeys[0].fingerprint != k.fingerprint {
+		t.Errorf("Shared key not recorded for bob: %+v", bob.authKeys)
+	}
+}
+
+func TestAuthKeysCmd(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+	dir := t.TempDir()
+	// Enough users that listing them in the command would exceed the
+	// maximum length of a single argument.
+	var passwd bytes.Buffer
+	fmt.Fprintf(&passwd, "o'brien:x:1000:1000:Quote:%s/o'brien:/bin/bash\n", dir)
+	for n := 0; n < 2000; n++ {
+		fmt.Fprintf(&passwd, "user%04d:x:%d:100::%s/user%04d:/bin/bash\n", n, 2000+n, dir, n)
+	}
+	passwdFile := path.Join(dir, "passwd")
+	if err := os.WriteFile(passwdFile, passwd.Bytes(), 0600); err != nil {
+		t.Fatalf("Unable to write passwd: %v", err)
+	}
+	for _, userName := range []string{"o'brien", "user1999"} {
+		if err := os.Mkdir(path.Join(dir, userName), 0700); err != nil {
+			t.Fatalf("Unable to create home: %v", err)
+		}
+		if err := os.WriteFile(path.Join(dir, userName, "keys"), []byte("ssh-ed25519 AAAA test\n"), 0600); err != nil {
+			t.Fatalf("Unable to write keys: %v", err)
+		}
+	}
+	marker := newMarker()
+	cmd := authKeysCmd("cat "+shellQuote(passwdFile), marker, []string{"missing", "none", "keys"})
+	if len(cmd) > 1024 {
+		t.Errorf("Command length depends on the number of users: %d bytes", len(cmd))
+	}
+	out, err := exec.Command("sh", "-c", cmd).CombinedOutput()
+	if err != nil {
+		t.Fatalf("Generated command failed: %v: %s", err, out)
+	}
+	expected := fmt.Sprintf(
+		"%so'brien %s/o'brien/keys\nssh-ed25519 AAAA test\n\n%suser1999 %s/user1999/keys\nssh-ed25519 AAAA test\n\n",
+		marker, dir, marker, dir,
+	)
+	if string(out) != expected {
+		t.Errorf("Unexpected output: Wanted=%q, Got=%q", expected, out)
+	}
+	if cmd := authKeysCmd("cat /etc/passwd", marker, []string{"none"}); cmd != "true" {
+		t.Errorf("Unexpected command without key files: %s", cmd)
+	}
+}
+
+func TestWriteKeysToFile(t *testing.T) {
+	sharedPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	ownPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	shared, own := authorizedKey(t, sharedPub), authorizedKey(t, ownPub)
+	hosts := newHosts()
+	var passwd bytes.Buffer
+	passwd.WriteString("alice:x:1000:1000:Alice:/home/alice:/bin/bash\n")
+	passwd.WriteString("bob:x:1001:1001:Bob:/home/bob:/bin/bash\n")
+	hosts.parsePasswd("host01", "files", passwd)
+	hosts.sortAll()
+	marker := newMarker()
+	var b bytes.Buffer
+	// alice lists the shared key in both files and her own key twice
+	fmt.Fprintf(&b, "%salice /home/alice/.ssh/authorized_keys\n%s\n%s\n%s\n", marker, shared, own, own)
+	fmt.Fprintf(&b, "%salice /home/alice/.ssh/authorized_keys2\n%s\n", marker, shared)
+	fmt.Fprintf(&b, "%sbob /home/bob/.ssh/authorized_keys\n%s\n", marker, shared)
+	hosts.parseAuthKeys("host01", marker, b)
+	fileName := path.Join(t.TempDir(), "keys.csv")
+	hosts.writeKeysToFile(fileName)
+	f, err := os.Open(fileName)
+	if err != nil {
+		t.Fatalf("Unable to read output: %v", err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("Unable to parse output: %v", err)
+	}
+	if len(records) != 5 {
+		t.Fatalf("Unexpected record count: Wanted=5, Got=%d", len(records))
+	}
+	fingerprint := func(key string) string {
+		pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key))
+		if err != nil {
+			t.Fatalf("Unable to parse key: %v", err)
+		}
+		return ssh.FingerprintSHA256(pub)
+	}
+	reuse := map[string]string{fingerprint(shared): "2", fingerprint(own): "1"}
+	for _, r := range records {
+		if r[8] != reuse[r[5]] {
+			t.Errorf("%s %s: Unexpected reuse count: Wanted=%s, Got=%s", r[1], r[2], reuse[r[5]], r[8])
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+)
+
+// parseMasterPasswd extracts the password hash and expiry dates from the
+// content of a BSD /etc/master.passwd file.  Its ten fields are:
+// name:password:uid:gid:class:change:expire:gecos:home_dir:shell.  Change is
+// the time by which the password must be changed and expire is the time the
+// account expires, both in seconds since the Epoch.  Zero means never.
+func (h *hostsInfo) parseMasterPasswd(hostName string, b bytes.Buffer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, line := range strings.Split(b.String(), "\n") {
+		fields := strings.Split(line, ":")
+		if len(fields) != 10 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		u, exists := h.users[hostName][fields[0]]
+		if !exists {
+			continue
+		}
+		u.hash, u.hashStrength, u.locked = classifyHash(fields[1])
+		secsToDays := func(s string) int {
+			n := atoiDefault(s)
+			if n <= 0 {
+				return -1
+			}
+			return n / (3600 * 24)
+		}
+		u.aging.pwExpire = secsToDays(fields[5])
+		u.aging.expire = secsToDays(fields[6])
+		h.users[hostName][fields[0]] = u
+	}
+}
+
+// bsdShadow collects the password data of a FreeBSD, OpenBSD, NetBSD or
+// DragonFly host.
+var bsdShadow = &collector{
+	name:       "shadow",
+	supports:   isBSD,
+	privileged: true,
+	command:    staticCommand("cat /etc/master.passwd"),
+	parse: func(s *hostSession, b bytes.Buffer) error {
+		s.hosts.parseMasterPasswd(s.hostName, b)
+		return nil
+	},
+}
+
+// bsdLast collects the login history of a BSD host.  FreeBSD's lastlogin
+// reports the most recent login of every user, even if it has been rotated
+// out of wtmp.  Systems without it fall back to last.
+var bsdLast = &collector{
+	name:     "last",
+	supports: isBSD,
+	command:  staticCommand("sh -c 'export LC_ALL=C; lastlogin 2>/dev/null || last'"),
+	parse: func(s *hostSession, b bytes.Buffer) error {
+		s.parseLastOutput(b)
+		return nil
+	},
+}
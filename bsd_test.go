@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCollectBSD(t *testing.T) {
+	hosts := newHosts()
+	outputs := map[string]string{
+		"cat /etc/passwd": `root:*:0:0:Charlie &:/root:/bin/csh
+alice:*:1001:1001:Alice:/home/alice:/bin/sh
+bob:*:1002:1002:Bob:/home/bob:/bin/sh
+`,
+		"cat /etc/master.passwd": `# $FreeBSD$
+root:$6$salt$hash:0:0::0:0:Charlie &:/root:/bin/csh
+alice:$6$salt$hash:1001:1001::1704067200:1735689600:Alice:/home/alice:/bin/sh
+bob:*LOCKED*$6$salt$hash:1002:1002::0:0:Bob:/home/bob:/bin/sh
+`,
+		"sh -c 'export LC_ALL=C; lastlogin 2>/dev/null || last'": `alice            pts/0    10.0.0.5         Tue Jan  9 10:11:12 2024
+root             ttyv0                     Mon Jan  1 09:00:00 2024
+`,
+	}
+	if messages := collectOutputs(t, hosts, "fbsd01", "FreeBSD", outputs, "shadow", "last"); len(messages) != 0 {
+		t.Errorf("Unexpected messages: %v", messages)
+	}
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	var tests = []struct {
+		user    string
+		locked  bool
+		columns string
+		from    string
+	}{
+		{"root", false, ",,,,,false,false,false,false,true", ""},
+		// The password had to be changed by 2024-01-01
+		{"alice", false, ",,,,2025-01-01,false,false,true,false,false", "10.0.0.5"},
+		{"bob", true, ",,,,,true,false,false,false,true", ""},
+	}
+	for _, tt := range tests {
+		u := hosts.users["fbsd01"][tt.user]
+		if u.hash != "sha512" || u.locked != tt.locked {
+			t.Errorf("%s: Unexpected hash: %s, locked=%v", tt.user, u.hash, u.locked)
+		}
+		if c := u.aging.columns(now, u.locked); c != tt.columns {
+			t.Errorf("%s: Unexpected aging: Wanted=%s, Got=%s", tt.user, tt.columns, c)
+		}
+		if u.lastLoginFrom != tt.from {
+			t.Errorf("%s: Unexpected login source: Wanted=%s, Got=%s", tt.user, tt.from, u.lastLoginFrom)
+		}
+	}
+	if root := hosts.users["fbsd01"]["root"]; root.lastLoginDate.Year() != 2024 {
+		t.Errorf("Unexpected root last login: %s", root.lastLoginDate)
+	}
+}
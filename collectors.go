@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/log-go"
+	"github.com/crooks/userlist/sshclient"
+)
+
+// runFunc executes a named command on a host and returns its output.  The
+// name determines the command's timeout.
+type runFunc func(name, cmd string) (bytes.Buffer, error)
+
+// hostSession is the state shared by the collectors run against a host.
+type hostSession struct {
+	hosts    *hostsInfo
+	hostName string // The name the host is reported as
+	osName   string // As reported by "uname -s"
+	messages []string
+}
+
+// warn records a non-fatal problem against the host.
+func (s *hostSession) warn(format string, a ...interface{}) {
+	msg := fmt.Sprintf(format, a...)
+	log.Infof("%s: %s", s.hostName, msg)
+	s.messages = append(s.messages, msg)
+}
+
+// Collector gathers and parses one kind of data from a host.  Collectors
+// run in the order they're registered, so a collector can rely on the data
+// gathered by those before it (for example, sudoers rules are resolved using
+// groups).
+type Collector interface {
+	// Name identifies the collector in the collectors config.  Variants of
+	// a collector for different operating systems share a name.
+	Name() string
+	// Supports returns true if the collector applies to an operating system,
+	// as reported by "uname -s".
+	Supports(osName string) bool
+	// Privileged returns true if the collector's commands must be run with
+	// the host's sudo command.
+	Privileged() bool
+	// Required returns true if the host can't be processed without this
+	// collector.  Required collectors can't be disabled and their failure
+	// ends processing of the host.
+	Required() bool
+	// Collect runs the collector's commands with run and parses their output
+	// into s.hosts.
+	Collect(s *hostSession, run runFunc) error
+}
+
+// collector is a Collector defined by a set of functions.  Most collectors
+// run a single command and parse its output, those that need to do more
+// define collect instead.
+type collector struct {
+	name       string
+	supports   func(osName string) bool // nil means all operating systems
+	privileged bool
+	required   bool
+	optional   bool // Failures are expected on some hosts and not reported
+	partial    bool // Output is parsed even if the command fails
+	command    func(s *hostSession) string
+	parse      func(s *hostSession, b bytes.Buffer) error
+	collect    func(s *hostSession, run runFunc) error
+}
+
+func (c *collector) Name() string     { return c.name }
+func (c *collector) Privileged() bool { return c.privileged }
+func (c *collector) Required() bool   { return c.required }
+
+func (c *collector) Supports(osName string) bool {
+	return c.supports == nil || c.supports(osName)
+}
+
+func (c *collector) Collect(s *hostSession, run runFunc) error {
+	var err error
+	if c.collect != nil {
+		err = c.collect(s, run)
+	} else {
+		var b bytes.Buffer
+		b, err = run(c.name, c.command(s))
+		if err == nil || c.partial && b.Len() > 0 {
+			err = c.parse(s, b)
+		}
+	}
+	if err != nil && c.optional {
+		log.Debugf("%s: %s: %v", s.hostName, c.name, err)
+		return nil
+	}
+	return err
+}
+
+// staticCommand returns a collector command function for a fixed command.
+func staticCommand(cmd string) func(*hostSession) string {
+	return func(*hostSession) string { return cmd }
+}
+
+// onlyOS returns a supports function for the listed operating systems.
+func onlyOS(names ...string) func(string) bool {
+	return func(osName string) bool { return stringInSlice(osName, names) }
+}
+
+// isBSD returns true if osName, as reported by "uname -s", is a BSD.
+func isBSD(osName string) bool {
+	return stringInSlice(osName, []string{"FreeBSD", "OpenBSD", "NetBSD", "DragonFly"})
+}
+
+// isLinux returns true for operating systems that don't have their own
+// collectors.  They're assumed to be Linux compatible.
+func isLinux(osName string) bool {
+	return osName != "AIX" && osName != "SunOS" && !isBSD(osName)
+}
+
+// getent returns the getent command for an NSS database in getent
+// collection mode, otherwise the command to read the local file.
+func getent(database, file string) func(*hostSession) string {
+	return func(*hostSession) string {
+		if cfg.CollectionMode == "getent" {
+			return "getent " + database
+		}
+		return "cat " + file
+	}
+}
+
+// passwdCmd returns the command that lists every user on the host, for
+// commands that examine each user's files.
+func (s *hostSession) passwdCmd() string {
+	return getent("passwd", "/etc/passwd")(s)
+}
+
+// collectors is the registry of collectors, in the order they're run.
+var collectors = []Collector{
+	&collector{
+		name:     "logindefs",
+		optional: true,
+		collect: func(s *hostSession, run runFunc) error {
+			if !cfg.UIDRange.LoginDefs {
+				return nil
+			}
+			b, err := run("passwd", "cat /etc/login.defs")
+			if err != nil {
+				return err
+			}
+			s.hosts.setUIDRange(s.hostName, parseLoginDefs(b, uidRange{min: cfg.UIDRange.Min, max: cfg.UIDRange.Max}))
+			return nil
+		},
+	},
+	&collector{
+		name:     "passwd",
+		required: true,
+		command:  staticCommand("cat /etc/passwd"),
+		parse: func(s *hostSession, b bytes.Buffer) error {
+			s.hosts.parsePasswd(s.hostName, "files", b)
+			return nil
+		},
+	},
+	// In getent mode, users provided by NSS (SSSD, LDAP, NIS, etc.) are
+	// included alongside those in the local files.
+	&collector{
+		name: "nss",
+		collect: func(s *hostSession, run runFunc) error {
+			if cfg.CollectionMode != "getent" {
+				return nil
+			}
+			b, err := run("passwd", "getent passwd")
+			if err != nil {
+				return err
+			}
+			s.hosts.parsePasswd(s.hostName, "nss", b)
+			return nil
+		},
+	},
+	linuxShadow,
+	aixShadow,
+	bsdShadow,
+	solarisShadow,
+	&collector{
+		name:    "group",
+		command: getent("group", "/etc/group"),
+		parse: func(s *hostSession, b bytes.Buffer) error {
+			s.hosts.parseGroup(s.hostName, b)
+			return nil
+		},
+	},
+	// gshadow is optional, it's not present on all systems.
+	&collector{
+		name:       "gshadow",
+		privileged: true,
+		optional:   true,
+		command:    staticCommand("cat /etc/gshadow"),
+		parse: func(s *hostSession, b bytes.Buffer) error {
+			s.hosts.parseGshadow(s.hostName, b)
+			return nil
+		},
+	},
+	// Sudoers must be parsed after groups so that %group rules can be
+	// resolved into users.
+	&collector{
+		name:       "sudoers",
+		privileged: true,
+		partial:    true,
+		command:    staticCommand("sh -c 'cat /etc/sudoers /etc/sudoers.d/* 2>/dev/null'"),
+		parse: func(s *hostSession, b bytes.Buffer) error {
+			s.hosts.parseSudoers(s.hostName, b)
+			return nil
+		},
+	},
+	&collector{
+		name:       "authkeys",
+		privileged: true,
+		collect: func(s *hostSession, run runFunc) error {
+			// The location of authorized_keys files is defined by sshd.
+			// "sshd -T" returns the effective config but isn't available
+			// everywhere.
+			b, err := run("sshd", "sh -c 'sshd -T 2>/dev/null || cat /etc/ssh/sshd_config'")
+			if err != nil && b.Len() == 0 {
+				log.Debugf("%s: Cannot read sshd config: %v", s.hostName, err)
+			}
+			keyFiles := authorizedKeysFiles(b)
+			marker := newMarker()
+			b, err = run("authkeys", authKeysCmd(s.passwdCmd(), marker, keyFiles))
+			if err != nil && b.Len() == 0 {
+				return err
+			}
+			s.hosts.parseAuthKeys(s.hostName, marker, b)
+			return nil
+		},
+	},
+	&collector{
+		name:       "homes",
+		privileged: true,
+		collect: func(s *hostSession, run runFunc) error {
+			var failed error
+			for _, homes := range argBatches(s.hosts.reportedHomes(s.hostName)) {
+				// Homes examined before a failure or timeout are still
+				// recorded.
+				b, err := run("homes", homesCmd(s.osName, homes))
+				if err != nil && b.Len() == 0 {
+					failed = err
+					continue
+				}
+				s.hosts.parseHomes(s.hostName, b)
+			}
+			return failed
+		},
+	},
+	// Jobs that run on behalf of users are found in crontabs, cron.d and
+	// enabled systemd units.
+	&collector{
+		name:       "jobs",
+		privileged: true,
+		collect: func(s *hostSession, run runFunc) error {
+			marker := newMarker()
+			b, err := run("jobs", jobsCmd(s.passwdCmd(), marker))
+			if err != nil && b.Len() == 0 {
+				return err
+			}
+			s.hosts.parseJobs(s.hostName, marker, b)
+			return nil
+		},
+	},
+	// A snapshot of current activity is optional, it supplements the login
+	// history.
+	&collector{
+		name:     "sessions",
+		optional: true,
+		command:  staticCommand(sessionsCmd),
+		parse: func(s *hostSession, b bytes.Buffer) error {
+			s.hosts.parseSessions(s.hostName, b)
+			return nil
+		},
+	},
+	&collector{
+		name:     "processes",
+		optional: true,
+		command:  staticCommand(processesCmd),
+		parse: func(s *hostSession, b bytes.Buffer) error {
+			s.hosts.parseProcesses(s.hostName, b)
+			return nil
+		},
+	},
+	linuxLast,
+	linuxBtmp,
+	aixLast,
+	bsdLast,
+	solarisLast,
+}
+
+// registerCollector adds a collector to the end of the registry.  Site
+// specific collectors can be added by calling it from an init function in a
+// separate file.
+func registerCollector(c Collector) {
+	collectors = append(collectors, c)
+}
+
+// collectorNames returns the names of all registered collectors.
+func collectorNames() []string {
+	var names []string
+	for _, c := range collectors {
+		if !stringInSlice(c.Name(), names) {
+			names = append(names, c.Name())
+		}
+	}
+	return names
+}
+
+// checkCollectorNames warns about collector names in the config that don't
+// match any registered collector.
+func checkCollectorNames(names []string) {
+	known := collectorNames()
+	for _, name := range names {
+		if !stringInSlice(name, known) {
+			log.Warnf("Unknown collector %q in config, known collectors are: %s", name, strings.Join(known, ", "))
+		}
+	}
+}
+
+// collect runs each registered collector that supports the host's operating
+// system and is enabled.  Required collectors always run.  Commands of
+// privileged collectors are wrapped by privileged.  Failures are recorded as
+// messages against the host, except that of a required collector, which is
+// returned.  Once ctx expires, no further collectors are run and an
+// ErrTimeout is returned.
+func (s *hostSession) collect(ctx context.Context, run runFunc, enabled func(name string) bool, privileged func(cmd string) string) error {
+	for _, c := range collectors {
+		if !c.Supports(s.osName) || !c.Required() && !enabled(c.Name()) {
+			continue
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("%w: host deadline expired before %s", sshclient.ErrTimeout, c.Name())
+		}
+		collectorRun := run
+		if c.Privileged() {
+			collectorRun = func(name, cmd string) (bytes.Buffer, error) {
+				return run(name, privileged(cmd))
+			}
+		}
+		err := c.Collect(s, collectorRun)
+		if err == nil {
+			if c.Name() == "last" {
+				s.hosts.setLoginsKnown(s.hostName)
+			}
+			continue
+		}
+		if c.Required() {
+			return fmt.Errorf("%s: %w", c.Name(), err)
+		}
+		s.warn("%s: %v", c.Name(), err)
+	}
+	return nil
+}
+
+// parseLastOutput parses the output of a "last" command, reporting any lines
+// that couldn't be parsed.
+func (s *hostSession) parseLastOutput(b bytes.Buffer) {
+	if warnings := s.hosts.parseLast(s.hostName, b, time.Now()); warnings > 0 {
+		s.warn("last: %d unparseable lines", warnings)
+	}
+}
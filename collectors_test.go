@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/crooks/userlist/sshclient"
+)
+
+// collectOutputs runs the named collectors (and any required ones) against a
+// fake host whose commands return the given outputs.  Unknown commands
+// return nothing.  It returns the messages recorded against the host.
+func collectOutputs(t *testing.T, hosts *hostsInfo, hostName, osName string, outputs map[string]string, names ...string) []string {
+	t.Helper()
+	run := func(name, cmd string) (bytes.Buffer, error) {
+		return *bytes.NewBufferString(outputs[cmd]), nil
+	}
+	s := &hostSession{hosts: hosts, hostName: hostName, osName: osName}
+	enabled := func(name string) bool { return stringInSlice(name, names) }
+	if err := s.collect(context.Background(), run, enabled, func(cmd string) string { return cmd }); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return s.messages
+}
+
+func TestCollectorSupports(t *testing.T) {
+	var tests = []struct {
+		osName string
+		shadow *collector
+	}{
+		{"Linux", linuxShadow},
+		{"GNU/kFreeBSD", linuxShadow},
+		{"AIX", aixShadow},
+		{"FreeBSD", bsdShadow},
+		{"OpenBSD", bsdShadow},
+		{"SunOS", solarisShadow},
+	}
+	for _, tt := range tests {
+		var found []Collector
+		for _, c := range collectors {
+			if c.Name() == "shadow" && c.Supports(tt.osName) {
+				found = append(found, c)
+			}
+		}
+		if len(found) != 1 || found[0] != tt.shadow {
+			t.Errorf("%s: Expected exactly one shadow collector, got %d", tt.osName, len(found))
+		}
+	}
+}
+
+func TestCollect(t *testing.T) {
+	var ran []string
+	fail := errors.New("permission denied")
+	run := func(name, cmd string) (bytes.Buffer, error) {
+		ran = append(ran, cmd)
+		switch cmd {
+		case "cat /etc/passwd":
+			return *bytes.NewBufferString("alice:x:1001:1001:Alice:/home/alice:/bin/sh\n"), nil
+		case "sudo cat /etc/master.passwd":
+			return bytes.Buffer{}, fail
+		}
+		return bytes.Buffer{}, nil
+	}
+	s := &hostSession{hosts: newHosts(), hostName: "fbsd01", osName: "FreeBSD"}
+	enabled := func(name string) bool { return name == "shadow" || name == "sessions" }
+	if err := s.collect(context.Background(), run, enabled, func(cmd string) string { return "sudo " + cmd }); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Only passwd (required), the BSD shadow collector and sessions should
+	// have run.  Shadow is privileged, sessions isn't.
+	expected := []string{"cat /etc/passwd", "sudo cat /etc/master.passwd", sessionsCmd}
+	if strings.Join(ran, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected commands: Wanted=%q, Got=%q", expected, ran)
+	}
+	if len(s.messages) != 1 || s.messages[0] != "shadow: permission denied" {
+		t.Errorf("Unexpected messages: %v", s.messages)
+	}
+	if _, ok := s.hosts.users["fbsd01"]["alice"]; !ok {
+		t.Error("alice should have been collected")
+	}
+
+	// A failing required collector ends collection.
+	ran = nil
+	run = func(name, cmd string) (bytes.Buffer, error) {
+		ran = append(ran, cmd)
+		return bytes.Buffer{}, fail
+	}
+	s = &hostSession{hosts: newHosts(), hostName: "fbsd02", osName: "FreeBSD"}
+	err := s.collect(context.Background(), run, enabled, func(cmd string) string { return cmd })
+	if !errors.Is(err, fail) || len(ran) != 1 {
+		t.Errorf("Expected passwd failure to end collection: err=%v, ran=%q", err, ran)
+	}
+
+	// Collection stops once the host deadline expires.
+	ran = nil
+	ctx, cancel := context.WithCancel(context.Background())
+	run = func(name, cmd string) (bytes.Buffer, error) {
+		ran = append(ran, cmd)
+		cancel()
+		return *bytes.NewBufferString("alice:x:1001:1001:Alice:/home/alice:/bin/sh\n"), nil
+	}
+	s = &hostSession{hosts: newHosts(), hostName: "fbsd03", osName: "FreeBSD"}
+	err = s.collect(ctx, run, enabled, func(cmd string) string { return cmd })
+	if !errors.Is(err, sshclient.ErrTimeout) || len(ran) != 1 {
+		t.Errorf("Expected the host deadline to end collection: err=%v, ran=%q", err, ran)
+	}
+	if errStatus(err) != "timeout" {
+		t.Errorf("Unexpected status: Wanted=timeout, Got=%s", errStatus(err))
+	}
+}
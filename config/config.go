@@ -3,11 +3,16 @@ package config
 import (
 	"errors"
 	"flag"
+	"fmt"
+	"net"
 	"os"
 	"os/user"
 	"path"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/crooks/userlist/sshconfig"
 	"gopkg.in/yaml.v3"
 )
 
@@ -16,22 +21,137 @@ type Flags struct {
 	PWOnly bool
 }
 
+// JumpHost defines the jump host(s) used to reach hosts matching a glob
+// Pattern or originating from a given Source (a URL, filename or "servers").
+// Via is a comma separated chain of [user@]host[:port] hops, or "none" to
+// connect directly.
+type JumpHost struct {
+	Pattern string `yaml:"pattern"`
+	Source  string `yaml:"source"`
+	Via     string `yaml:"via"`
+}
+
+// Timeouts contains the timeouts that can be defined globally or per host.
+type Timeouts struct {
+	SSHTimeout      string            `yaml:"ssh_timeout"`
+	HostTimeout     string            `yaml:"host_timeout"`
+	CommandTimeout  string            `yaml:"command_timeout"`
+	CommandTimeouts map[string]string `yaml:"command_timeouts"`
+	// Parsed versions of the timeout strings
+	sshTimeout      time.Duration
+	hostTimeout     time.Duration
+	commandTimeout  time.Duration
+	commandTimeouts map[string]time.Duration
+}
+
+// DefaultExcludeShells are the shells of accounts that aren't reported unless
+// shells.exclude is defined.
+var DefaultExcludeShells = []string{"nologin", "false", "sync", "shutdown", "halt"}
+
+// Shells defines which login shells are reported.  Each shell may be given as
+// a full path or a basename.  If Include is defined, only users with a listed
+// shell are reported.  Users with a shell in Exclude are never reported.
+type Shells struct {
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+}
+
+// UIDRange defines the UIDs allocated to human (as opposed to system)
+// accounts.  If LoginDefs is true, UID_MIN and UID_MAX are read from each
+// host's /etc/login.defs and take precedence over Min and Max.  Report
+// determines which accounts are written to out_file: all, human or system.
+type UIDRange struct {
+	Min       int    `yaml:"min"`
+	Max       int    `yaml:"max"`
+	LoginDefs bool   `yaml:"login_defs"`
+	Report    string `yaml:"report"`
+}
+
+// Collectors enables or disables data collectors by name.  Collectors are
+// enabled unless disabled.  Within a host override, Enable re-enables
+// collectors that are disabled globally.
+type Collectors struct {
+	Enable  []string `yaml:"enable"`
+	Disable []string `yaml:"disable"`
+}
+
+// HostOverride defines settings that apply to hosts matching a glob Pattern.
+// Undefined settings retain their global value.
+type HostOverride struct {
+	Pattern     string     `yaml:"pattern"`
+	User        string     `yaml:"user"`
+	Port        int        `yaml:"port"`
+	PrivateKeys []string   `yaml:"private_keys"`
+	Sudo        string     `yaml:"sudo"`
+	Collectors  Collectors `yaml:"collectors"`
+	Timeouts    `yaml:",inline"`
+}
+
+// Host contains the settings for a single host after any overrides have been
+// applied.  PrivateKeys is only populated when overridden, otherwise the
+// global keys apply.
+type Host struct {
+	HostName        string
+	ProxyJump       string
+	User            string
+	Port            int
+	PrivateKeys     []string
+	SudoCommand     string
+	SSHTimeout      time.Duration
+	HostTimeout     time.Duration
+	commandTimeout  time.Duration
+	commandTimeouts map[string]time.Duration
+	disabled        map[string]bool // Collectors disabled for the host
+}
+
 // Config contains the userlist configuration options
 type Config struct {
-	CollisionsCSV string   `yaml:"collisions_file"`
-	DefaultDomain string   `yaml:"default_domain"`
-	LogFile       string   `yaml:"logfile"`
-	LogLevel      string   `yaml:"loglevel"`
-	OutFileCSV    string   `yaml:"out_file"`
-	PrivateKeys   []string `yaml:"private_keys"`
-	SSHTimeout    string   `yaml:"ssh_timeout"`
-	SSHUser       string   `yaml:"ssh_user"`
-	UIDMapCSV     string   `yaml:"uidmap_file"`
-	Sources       struct {
+	CollectionMode   string         `yaml:"collection_mode"`
+	CollisionsCSV    string         `yaml:"collisions_file"`
+	Collectors       Collectors     `yaml:"collectors"`
+	Concurrency      int            `yaml:"concurrency"`
+	DefaultDomain    string         `yaml:"default_domain"`
+	GIDCollisionsCSV string         `yaml:"gid_collisions_file"`
+	GroupsCSV        string         `yaml:"groups_file"`
+	HostOverrides    []HostOverride `yaml:"host_overrides"`
+	JSONFile         string         `yaml:"json_file"`
+	JumpHosts        []JumpHost     `yaml:"jump_hosts"`
+	JobsCSV          string         `yaml:"jobs_file"`
+	KeysCSV          string         `yaml:"keys_file"`
+	KnownHosts       struct {
+		Mode     string   `yaml:"mode"`
+		Files    []string `yaml:"files"`
+		TOFUFile string   `yaml:"tofu_file"`
+	} `yaml:"known_hosts"`
+	LogFile        string   `yaml:"logfile"`
+	LogLevel       string   `yaml:"loglevel"`
+	LoginSource    string   `yaml:"login_source"`
+	NamePriority   []string `yaml:"name_priority"`
+	OutFileCSV     string   `yaml:"out_file"`
+	PassphraseEnv  string   `yaml:"passphrase_env"`
+	PassphraseFile string   `yaml:"passphrase_file"`
+	PrivateKeys    []string `yaml:"private_keys"`
+	PrivilegedCSV  string   `yaml:"privileged_file"`
+	ProxyJump      string   `yaml:"proxy_jump"`
+	ResultsCSV     string   `yaml:"results_file"`
+	SSHAgent       bool     `yaml:"ssh_agent"`
+	SSHConfig      string   `yaml:"ssh_config"`
+	Shells         Shells   `yaml:"shells"`
+	SSHUser        string   `yaml:"ssh_user"`
+	StaleDays      int      `yaml:"stale_days"`
+	SudoCommand    string   `yaml:"sudo_command"`
+	Timeouts       `yaml:",inline"`
+	UIDRange       UIDRange `yaml:"uid_range"`
+	UIDMapCSV      string   `yaml:"uidmap_file"`
+	Sources        struct {
 		URLs    []string `yaml:"urls"`
 		Files   []string `yaml:"files"`
 		Servers []string `yaml:"servers"`
+		// Local audits the host userlist is running on, without SSH
+		Local bool `yaml:"local"`
 	} `yaml:"sources"`
+	// sshConfig is the parsed content of the SSHConfig file
+	sshConfig *sshconfig.Config
 }
 
 func ParseConfig(filename string) (*Config, error) {
@@ -52,6 +172,33 @@ func ParseConfig(filename string) (*Config, error) {
 	if config.SSHTimeout == "" {
 		config.SSHTimeout = "10s"
 	}
+	if config.HostTimeout == "" {
+		config.HostTimeout = "5m"
+	}
+	if config.CommandTimeout == "" {
+		config.CommandTimeout = "1m"
+	}
+	if config.CollectionMode == "" {
+		config.CollectionMode = "files"
+	}
+	if config.LoginSource == "" {
+		config.LoginSource = "last"
+	}
+	if config.SudoCommand == "" {
+		config.SudoCommand = "sudo"
+	}
+	if config.ResultsCSV == "" {
+		config.ResultsCSV = "host_results.csv"
+	}
+	if config.KnownHosts.Mode == "" {
+		config.KnownHosts.Mode = "tofu"
+	}
+	if config.KnownHosts.Files == nil {
+		config.KnownHosts.Files = []string{"~/.ssh/known_hosts"}
+	}
+	if config.KnownHosts.TOFUFile == "" {
+		config.KnownHosts.TOFUFile = "~/.userlist/known_hosts"
+	}
 	if config.CollisionsCSV == "" {
 		config.CollisionsCSV = "uid_conflict.csv"
 	}
@@ -61,17 +208,128 @@ func ParseConfig(filename string) (*Config, error) {
 	if config.UIDMapCSV == "" {
 		config.UIDMapCSV = "uid_map.csv"
 	}
+	if config.GroupsCSV == "" {
+		config.GroupsCSV = "groups.csv"
+	}
+	if config.GIDCollisionsCSV == "" {
+		config.GIDCollisionsCSV = "gid_conflict.csv"
+	}
+	if config.PrivilegedCSV == "" {
+		config.PrivilegedCSV = "privileged.csv"
+	}
+	if config.KeysCSV == "" {
+		config.KeysCSV = "authorized_keys.csv"
+	}
+	if config.JobsCSV == "" {
+		config.JobsCSV = "jobs.csv"
+	}
+	if config.Concurrency == 0 {
+		config.Concurrency = 10
+	}
+	if config.Shells.Exclude == nil {
+		config.Shells.Exclude = DefaultExcludeShells
+	}
+	if config.UIDRange.Min == 0 {
+		config.UIDRange.Min = 1000
+	}
+	if config.UIDRange.Max == 0 {
+		config.UIDRange.Max = 60000
+	}
+	if config.StaleDays == 0 {
+		config.StaleDays = 90
+	}
+	if config.UIDRange.Report == "" {
+		config.UIDRange.Report = "all"
+	}
 	// Allow for tilde expansion on these config options
 	config.CollisionsCSV = expandTilde(config.CollisionsCSV)
 	config.OutFileCSV = expandTilde(config.OutFileCSV)
+	config.ResultsCSV = expandTilde(config.ResultsCSV)
 	config.UIDMapCSV = expandTilde(config.UIDMapCSV)
+	config.GroupsCSV = expandTilde(config.GroupsCSV)
+	config.GIDCollisionsCSV = expandTilde(config.GIDCollisionsCSV)
+	config.PrivilegedCSV = expandTilde(config.PrivilegedCSV)
+	config.KeysCSV = expandTilde(config.KeysCSV)
+	config.JobsCSV = expandTilde(config.JobsCSV)
+	config.JSONFile = expandTilde(config.JSONFile)
+	config.KnownHosts.TOFUFile = expandTilde(config.KnownHosts.TOFUFile)
+	config.PassphraseFile = expandTilde(config.PassphraseFile)
+	config.SSHConfig = expandTilde(config.SSHConfig)
+	for n := range config.KnownHosts.Files {
+		config.KnownHosts.Files[n] = expandTilde(config.KnownHosts.Files[n])
+	}
 	// Others cannot be guessed and must be user defined
-	if len(config.Sources.Servers)+len(config.Sources.Files)+len(config.Sources.URLs) == 0 {
+	if !config.Sources.Local && !config.RemoteSources() {
 		return nil, errors.New("no sources are defined")
 	}
-	if config.SSHUser == "" {
+	if config.SSHUser == "" && config.RemoteSources() {
 		return nil, errors.New("ssh_user is not defined")
 	}
+	if config.Concurrency < 0 {
+		return nil, errors.New("concurrency cannot be negative")
+	}
+	if config.StaleDays < 0 {
+		return nil, errors.New("stale_days cannot be negative")
+	}
+	if config.CollectionMode != "files" && config.CollectionMode != "getent" {
+		return nil, fmt.Errorf("collection_mode: unknown mode: %s", config.CollectionMode)
+	}
+	if config.LoginSource != "last" && config.LoginSource != "files" {
+		return nil, fmt.Errorf("login_source: unknown source: %s", config.LoginSource)
+	}
+	for _, rule := range config.NamePriority {
+		switch {
+		case rule == "common", rule == "longest", rule == "files", rule == "nss":
+		case strings.HasPrefix(rule, "host:"):
+		default:
+			return nil, fmt.Errorf("name_priority: unknown rule: %s", rule)
+		}
+	}
+	if config.UIDRange.Min > config.UIDRange.Max {
+		return nil, errors.New("uid_range: min cannot exceed max")
+	}
+	switch config.UIDRange.Report {
+	case "all", "human", "system":
+	default:
+		return nil, fmt.Errorf("uid_range: unknown report: %s", config.UIDRange.Report)
+	}
+	switch config.KnownHosts.Mode {
+	case "strict", "tofu", "warn":
+	default:
+		return nil, fmt.Errorf("known_hosts: unknown mode: %s", config.KnownHosts.Mode)
+	}
+	for _, j := range config.JumpHosts {
+		if j.Via == "" {
+			return nil, errors.New("jump_hosts: via is not defined")
+		}
+		if j.Pattern == "" && j.Source == "" {
+			return nil, fmt.Errorf("jump_hosts: %s: requires a pattern or source", j.Via)
+		}
+		if _, err := path.Match(j.Pattern, ""); err != nil {
+			return nil, fmt.Errorf("jump_hosts: %s: %w", j.Pattern, err)
+		}
+	}
+	if config.SSHConfig != "" {
+		config.sshConfig, err = sshconfig.ParseFile(config.SSHConfig)
+		if err != nil {
+			return nil, fmt.Errorf("ssh_config: %w", err)
+		}
+	}
+	if err := config.Timeouts.parse(); err != nil {
+		return nil, err
+	}
+	for n := range config.HostOverrides {
+		o := &config.HostOverrides[n]
+		if _, err := path.Match(o.Pattern, ""); err != nil || o.Pattern == "" {
+			return nil, fmt.Errorf("host_overrides: invalid pattern: \"%s\"", o.Pattern)
+		}
+		if err := o.Timeouts.parse(); err != nil {
+			return nil, fmt.Errorf("host_overrides: %s: %w", o.Pattern, err)
+		}
+		for k := range o.PrivateKeys {
+			o.PrivateKeys[k] = expandTilde(o.PrivateKeys[k])
+		}
+	}
 	// Check if the various output files are writable.  It's much less overhead
 	// to find out now instead of during post-processing.
 	err = touchAndDel(config.CollisionsCSV)
@@ -86,6 +344,37 @@ func ParseConfig(filename string) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = touchAndDel(config.ResultsCSV)
+	if err != nil {
+		return nil, err
+	}
+	err = touchAndDel(config.GroupsCSV)
+	if err != nil {
+		return nil, err
+	}
+	err = touchAndDel(config.GIDCollisionsCSV)
+	if err != nil {
+		return nil, err
+	}
+	err = touchAndDel(config.PrivilegedCSV)
+	if err != nil {
+		return nil, err
+	}
+	err = touchAndDel(config.KeysCSV)
+	if err != nil {
+		return nil, err
+	}
+	err = touchAndDel(config.JobsCSV)
+	if err != nil {
+		return nil, err
+	}
+	// The JSON output is optional
+	if config.JSONFile != "" {
+		err = touchAndDel(config.JSONFile)
+		if err != nil {
+			return nil, err
+		}
+	}
 	// Iterate over the given Private keys and expand tildes
 	for n := range config.PrivateKeys {
 		config.PrivateKeys[n] = expandTilde(config.PrivateKeys[n])
@@ -93,6 +382,232 @@ func ParseConfig(filename string) (*Config, error) {
 	return config, nil
 }
 
+// parse converts the various timeout strings into durations.  Undefined
+// timeouts are left as zero.
+func (t *Timeouts) parse() (err error) {
+	parse := func(name, s string) (time.Duration, error) {
+		if s == "" {
+			return 0, nil
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", name, err)
+		}
+		return d, nil
+	}
+	if t.sshTimeout, err = parse("ssh_timeout", t.SSHTimeout); err != nil {
+		return
+	}
+	if t.hostTimeout, err = parse("host_timeout", t.HostTimeout); err != nil {
+		return
+	}
+	if t.commandTimeout, err = parse("command_timeout", t.CommandTimeout); err != nil {
+		return
+	}
+	t.commandTimeouts = make(map[string]time.Duration)
+	for name, s := range t.CommandTimeouts {
+		if t.commandTimeouts[name], err = parse("command_timeouts: "+name, s); err != nil {
+			return
+		}
+	}
+	return nil
+}
+
+// ForHost returns the settings for hostName.  If ssh_config is defined, the
+// settings it contains for hostName take precedence over the global settings.
+// All the host_overrides with a pattern matching hostName are then applied in
+// the order they're defined so later entries take precedence over earlier
+// ones.
+func (c *Config) ForHost(hostName string) *Host {
+	h := &Host{
+		ProxyJump:       c.ProxyJump,
+		User:            c.SSHUser,
+		Port:            22,
+		SudoCommand:     c.SudoCommand,
+		SSHTimeout:      c.sshTimeout,
+		HostTimeout:     c.hostTimeout,
+		commandTimeout:  c.commandTimeout,
+		commandTimeouts: make(map[string]time.Duration),
+		disabled:        make(map[string]bool),
+	}
+	for name, d := range c.commandTimeouts {
+		h.commandTimeouts[name] = d
+	}
+	for _, name := range c.Collectors.Disable {
+		h.disabled[name] = true
+	}
+	if c.sshConfig != nil {
+		sh := c.sshConfig.Lookup(hostName)
+		h.HostName = sh.HostName
+		if sh.ProxyJump != "" {
+			h.ProxyJump = sh.ProxyJump
+		}
+		if sh.User != "" {
+			h.User = sh.User
+		}
+		if sh.Port != 0 {
+			h.Port = sh.Port
+		}
+		// Identity files are offered ahead of, rather than in place of,
+		// the configured private_keys.
+		if len(sh.IdentityFiles) > 0 {
+			h.PrivateKeys = append(append([]string{}, sh.IdentityFiles...), c.PrivateKeys...)
+		}
+	}
+	for _, o := range c.HostOverrides {
+		if ok, _ := path.Match(o.Pattern, hostName); !ok {
+			continue
+		}
+		if o.User != "" {
+			h.User = o.User
+		}
+		if o.Port != 0 {
+			h.Port = o.Port
+		}
+		if len(o.PrivateKeys) > 0 {
+			h.PrivateKeys = o.PrivateKeys
+		}
+		if o.Sudo != "" {
+			h.SudoCommand = o.Sudo
+		}
+		if o.sshTimeout != 0 {
+			h.SSHTimeout = o.sshTimeout
+		}
+		if o.hostTimeout != 0 {
+			h.HostTimeout = o.hostTimeout
+		}
+		if o.commandTimeout != 0 {
+			h.commandTimeout = o.commandTimeout
+		}
+		for name, d := range o.commandTimeouts {
+			h.commandTimeouts[name] = d
+		}
+		for _, name := range o.Collectors.Disable {
+			h.disabled[name] = true
+		}
+		for _, name := range o.Collectors.Enable {
+			delete(h.disabled, name)
+		}
+	}
+	return h
+}
+
+// RemoteSources returns true if any of the sources define hosts that are
+// reached over SSH.
+func (c *Config) RemoteSources() bool {
+	return len(c.Sources.Servers)+len(c.Sources.Files)+len(c.Sources.URLs) > 0
+}
+
+// CollectorEnabled returns true if the named collector should be run on the
+// host.
+func (h *Host) CollectorEnabled(name string) bool {
+	return !h.disabled[name]
+}
+
+// CollectorNames returns every collector name referenced in the config.
+func (c *Config) CollectorNames() []string {
+	names := append([]string{}, c.Collectors.Enable...)
+	names = append(names, c.Collectors.Disable...)
+	for _, o := range c.HostOverrides {
+		names = append(names, o.Collectors.Enable...)
+		names = append(names, o.Collectors.Disable...)
+	}
+	return names
+}
+
+// Wanted returns true if users with the given login shell should be reported.
+func (s *Shells) Wanted(shell string) bool {
+	match := func(list []string) bool {
+		for _, item := range list {
+			if item == shell || item == path.Base(shell) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(s.Include) > 0 && !match(s.Include) {
+		return false
+	}
+	return !match(s.Exclude)
+}
+
+// CommandDeadline returns the time allowed for the named remote command.  If
+// the command has no specific timeout, the default command_timeout applies.
+func (h *Host) CommandDeadline(name string) time.Duration {
+	if d, ok := h.commandTimeouts[name]; ok {
+		return d
+	}
+	return h.commandTimeout
+}
+
+// Privileged prefixes cmd with the host's sudo command.  A sudo command of
+// "none" implies the command should be run unprivileged.
+func (h *Host) Privileged(cmd string) string {
+	if h.SudoCommand == "none" {
+		return cmd
+	}
+	return h.SudoCommand + " " + cmd
+}
+
+// JumpFor returns the chain of jump hosts required to reach hostName, which
+// was read from source.  Host patterns take precedence over sources, which in
+// turn take precedence over defaultJump.  An empty string implies a direct
+// connection.  If ssh_config is defined, each hop is resolved through it.
+func (c *Config) JumpFor(hostName, source, defaultJump string) string {
+	via := defaultJump
+	if j := c.matchJump(func(j JumpHost) bool {
+		ok, _ := path.Match(j.Pattern, hostName)
+		return j.Pattern != "" && ok
+	}); j != nil {
+		via = j.Via
+	} else if j := c.matchJump(func(j JumpHost) bool {
+		return j.Source != "" && j.Source == source
+	}); j != nil {
+		via = j.Via
+	}
+	if via == "none" {
+		return ""
+	}
+	return c.resolveJump(via)
+}
+
+// resolveJump looks up each hop of a jump chain in ssh_config.  Hops that
+// explicitly define a user or port are left alone.
+func (c *Config) resolveJump(chain string) string {
+	if c.sshConfig == nil || chain == "" {
+		return chain
+	}
+	hops := strings.Split(chain, ",")
+	for n, hop := range hops {
+		hop = strings.TrimSpace(hop)
+		if strings.ContainsAny(hop, "@:") {
+			continue
+		}
+		sh := c.sshConfig.Lookup(hop)
+		if sh.HostName != "" {
+			hop = sh.HostName
+		}
+		if sh.Port != 0 {
+			hop = net.JoinHostPort(hop, strconv.Itoa(sh.Port))
+		}
+		if sh.User != "" {
+			hop = sh.User + "@" + hop
+		}
+		hops[n] = hop
+	}
+	return strings.Join(hops, ",")
+}
+
+// matchJump returns the first JumpHost for which match returns true.
+func (c *Config) matchJump(match func(JumpHost) bool) *JumpHost {
+	for n := range c.JumpHosts {
+		if match(c.JumpHosts[n]) {
+			return &c.JumpHosts[n]
+		}
+	}
+	return nil
+}
+
 // touchAndDel creates and then removes a file.  This is a quick and dirty test
 // to see if a given filename can be written.
 func touchAndDel(filename string) error {
@@ -3,7 +3,11 @@ package config
 import (
 	"os"
 	"path"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/crooks/userlist/sshconfig"
 )
 
 func TestConfig(t *testing.T) {
@@ -43,3 +47,186 @@ func TestFlags(t *testing.T) {
 		t.Fatalf("Unexpected config flag: Expected=%s, Got=%s", expectingConfig, f.Config)
 	}
 }
+
+func TestForHost(t *testing.T) {
+	c := new(Config)
+	c.SSHUser = "audit"
+	c.SudoCommand = "sudo"
+	c.SSHTimeout = "10s"
+	c.HostTimeout = "5m"
+	c.CommandTimeout = "1m"
+	c.CommandTimeouts = map[string]string{"last": "90s"}
+	c.HostOverrides = []HostOverride{
+		{Pattern: "legacy*", User: "svc_audit", Port: 2222},
+		{Pattern: "legacy01", Sudo: "none"},
+	}
+	c.HostOverrides[1].CommandTimeout = "2m"
+	if err := c.Timeouts.parse(); err != nil {
+		t.Fatalf("Unable to parse timeouts: %v", err)
+	}
+	for n := range c.HostOverrides {
+		if err := c.HostOverrides[n].Timeouts.parse(); err != nil {
+			t.Fatalf("Unable to parse override timeouts: %v", err)
+		}
+	}
+	h := c.ForHost("web01")
+	if h.User != "audit" || h.Port != 22 {
+		t.Errorf("Unexpected defaults: Expected=audit:22, Got=%s:%d", h.User, h.Port)
+	}
+	if h.CommandDeadline("last") != 90*time.Second {
+		t.Errorf("Unexpected last timeout: Expected=90s, Got=%v", h.CommandDeadline("last"))
+	}
+	if h.CommandDeadline("shadow") != time.Minute {
+		t.Errorf("Unexpected default timeout: Expected=1m, Got=%v", h.CommandDeadline("shadow"))
+	}
+	if h.Privileged("cat /etc/shadow") != "sudo cat /etc/shadow" {
+		t.Errorf("Unexpected privileged command: %s", h.Privileged("cat /etc/shadow"))
+	}
+	h = c.ForHost("legacy01")
+	if h.User != "svc_audit" || h.Port != 2222 {
+		t.Errorf("Unexpected override: Expected=svc_audit:2222, Got=%s:%d", h.User, h.Port)
+	}
+	if h.CommandDeadline("shadow") != 2*time.Minute {
+		t.Errorf("Unexpected override timeout: Expected=2m, Got=%v", h.CommandDeadline("shadow"))
+	}
+	if h.Privileged("cat /etc/shadow") != "cat /etc/shadow" {
+		t.Errorf("Unexpected unprivileged command: %s", h.Privileged("cat /etc/shadow"))
+	}
+	c.CommandTimeouts["shadow"] = "forever"
+	if err := c.Timeouts.parse(); err == nil {
+		t.Error("Invalid timeout failed to return an error")
+	}
+}
+
+func TestJumpFor(t *testing.T) {
+	c := new(Config)
+	c.JumpHosts = []JumpHost{
+		{Pattern: "*.dmz.example.com", Via: "bastion-dmz"},
+		{Pattern: "direct*", Via: "none"},
+		{Source: "/etc/userlist/lab.txt", Via: "jump@bastion-lab:2222"},
+	}
+	var tests = []struct {
+		hostName string
+		source   string
+		expected string
+	}{
+		{"web01.dmz.example.com", "servers", "bastion-dmz"},
+		{"web01.dmz.example.com", "/etc/userlist/lab.txt", "bastion-dmz"},
+		{"lab01", "/etc/userlist/lab.txt", "jump@bastion-lab:2222"},
+		{"app01", "servers", "bastion"},
+		{"direct01", "servers", ""},
+	}
+	for _, tt := range tests {
+		via := c.JumpFor(tt.hostName, tt.source, "bastion")
+		if via != tt.expected {
+			t.Errorf("Unexpected jump for %s: Expected=%s, Got=%s", tt.hostName, tt.expected, via)
+		}
+	}
+}
+
+func TestSSHConfig(t *testing.T) {
+	sshCfg := `
+Host legacy01
+    HostName 192.0.2.10
+    User svc_audit
+    ProxyJump bastion
+    IdentityFile /etc/keys/legacy
+Host bastion
+    HostName bastion.example.com
+    Port 2222
+`
+	var err error
+	c := new(Config)
+	c.SSHUser = "audit"
+	c.PrivateKeys = []string{"/etc/keys/audit"}
+	c.sshConfig, err = sshconfig.Parse(strings.NewReader(sshCfg))
+	if err != nil {
+		t.Fatalf("Unable to parse ssh_config: %v", err)
+	}
+	c.HostOverrides = []HostOverride{{Pattern: "legacy01", Port: 2200}}
+	h := c.ForHost("legacy01")
+	if h.HostName != "192.0.2.10" || h.User != "svc_audit" || h.Port != 2200 {
+		t.Errorf("Unexpected host: Expected=svc_audit@192.0.2.10:2200, Got=%s@%s:%d", h.User, h.HostName, h.Port)
+	}
+	if keys := strings.Join(h.PrivateKeys, " "); keys != "/etc/keys/legacy /etc/keys/audit" {
+		t.Errorf("Unexpected private keys: Expected=/etc/keys/legacy /etc/keys/audit, Got=%s", keys)
+	}
+	jump := c.JumpFor("legacy01", "servers", h.ProxyJump)
+	if jump != "bastion.example.com:2222" {
+		t.Errorf("Unexpected jump: Expected=bastion.example.com:2222, Got=%s", jump)
+	}
+}
+
+func TestShellsWanted(t *testing.T) {
+	var tests = []struct {
+		shells   Shells
+		shell    string
+		expected bool
+	}{
+		{Shells{Exclude: DefaultExcludeShells}, "/bin/bash", true},
+		{Shells{Exclude: DefaultExcludeShells}, "/usr/sbin/nologin", false},
+		{Shells{Exclude: []string{"false"}}, "/usr/sbin/nologin", true},
+		{Shells{Exclude: []string{"/usr/local/bin/restricted"}}, "/usr/local/bin/restricted", false},
+		{Shells{Include: []string{"bash", "/bin/zsh"}}, "/bin/bash", true},
+		{Shells{Include: []string{"bash", "/bin/zsh"}}, "/usr/bin/zsh", false},
+		{Shells{Include: []string{"bash"}, Exclude: []string{"/bin/bash"}}, "/bin/bash", false},
+	}
+	for _, tt := range tests {
+		if got := tt.shells.Wanted(tt.shell); got != tt.expected {
+			t.Errorf("%+v: Unexpected result for %s: Wanted=%v, Got=%v", tt.shells, tt.shell, tt.expected, got)
+		}
+	}
+}
+
+func TestCollectorEnabled(t *testing.T) {
+	c := new(Config)
+	c.Collectors.Disable = []string{"jobs", "homes"}
+	c.HostOverrides = []HostOverride{
+		{Pattern: "db*", Collectors: Collectors{Enable: []string{"homes"}}},
+		{Pattern: "db02", Collectors: Collectors{Disable: []string{"sessions"}}},
+	}
+	var tests = []struct {
+		hostName  string
+		collector string
+		enabled   bool
+	}{
+		{"web01", "shadow", true},
+		{"web01", "jobs", false},
+		{"web01", "homes", false},
+		{"db01", "homes", true},
+		{"db01", "jobs", false},
+		{"db01", "sessions", true},
+		{"db02", "sessions", false},
+	}
+	for _, tt := range tests {
+		h := c.ForHost(tt.hostName)
+		if h.CollectorEnabled(tt.collector) != tt.enabled {
+			t.Errorf("%s: %s: Expected=%t, Got=%t", tt.hostName, tt.collector, tt.enabled, !tt.enabled)
+		}
+	}
+}
+
+func TestLocalSource(t *testing.T) {
+	testFile, err := os.CreateTemp("", "testcfg")
+	if err != nil {
+		t.Fatalf("Unable to create TempFile: %v", err)
+	}
+	defer os.Remove(testFile.Name())
+	// A local source doesn't require an SSH user
+	fakeCfg := new(Config)
+	fakeCfg.Sources.Local = true
+	fakeCfg.WriteConfig(testFile.Name())
+	cfg, err := ParseConfig(testFile.Name())
+	if err != nil {
+		t.Fatalf("Unable to parse local config: %v", err)
+	}
+	if cfg.RemoteSources() {
+		t.Error("A local source should not require remote access")
+	}
+	// Remote sources still do
+	fakeCfg.Sources.Servers = []string{"web01"}
+	fakeCfg.WriteConfig(testFile.Name())
+	if _, err := ParseConfig(testFile.Name()); err == nil || !strings.Contains(err.Error(), "ssh_user") {
+		t.Errorf("Expected an ssh_user error, got: %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"path"
+	"strings"
+)
+
+// gecos contains the subfields of the passwd comment field, as described in
+// passwd(5) and used by chfn.
+type gecos struct {
+	name      string
+	room      string
+	workPhone string
+	homePhone string
+	other     string // Frequently used for an email address or ticket number
+}
+
+// parseGECOS splits a passwd comment field into its subfields.  Any commas
+// within the "other" subfield are replaced with spaces so it can be safely
+// written to CSV.
+func parseGECOS(field string) gecos {
+	sub := strings.SplitN(field, ",", 5)
+	for len(sub) < 5 {
+		sub = append(sub, "")
+	}
+	return gecos{
+		name:      strings.TrimSpace(sub[0]),
+		room:      strings.TrimSpace(sub[1]),
+		workPhone: strings.TrimSpace(sub[2]),
+		homePhone: strings.TrimSpace(sub[3]),
+		other:     strings.TrimSpace(strings.ReplaceAll(sub[4], ",", " ")),
+	}
+}
+
+// columns returns the room, phones and other subfields formatted for CSV.
+func (g gecos) columns() string {
+	return strings.Join([]string{g.room, g.workPhone, g.homePhone, g.other}, ",")
+}
+
+// nameCandidate is a non-blank name found for a user on a given host.
+type nameCandidate struct {
+	host   string
+	source string
+	name   string
+}
+
+// preferName narrows candidates by each of the rules in priority, in order.
+// A rule that matches none of the remaining candidates is ignored.  Rules
+// are:
+//
+//	host:<pattern>  names from hosts matching a glob pattern
+//	files or nss    names from local files or from NSS (getent)
+//	common          the name found on the most hosts
+//	longest         the longest name
+//
+// The first of the remaining candidates is returned.
+func preferName(candidates []nameCandidate, priority []string) string {
+	if len(candidates) == 0 {
+		return ""
+	}
+	for _, rule := range priority {
+		var keep func(c nameCandidate) bool
+		switch {
+		case strings.HasPrefix(rule, "host:"):
+			pattern := strings.TrimPrefix(rule, "host:")
+			keep = func(c nameCandidate) bool {
+				ok, _ := path.Match(pattern, c.host)
+				return ok
+			}
+		case rule == "files" || rule == "nss":
+			keep = func(c nameCandidate) bool { return c.source == rule }
+		case rule == "common":
+			counts := make(map[string]int)
+			most := 0
+			for _, c := range candidates {
+				counts[c.name]++
+				if counts[c.name] > most {
+					most = counts[c.name]
+				}
+			}
+			keep = func(c nameCandidate) bool { return counts[c.name] == most }
+		case rule == "longest":
+			longest := 0
+			for _, c := range candidates {
+				if len(c.name) > longest {
+					longest = len(c.name)
+				}
+			}
+			keep = func(c nameCandidate) bool { return len(c.name) == longest }
+		default:
+			continue
+		}
+		var kept []nameCandidate
+		for _, c := range candidates {
+			if keep(c) {
+				kept = append(kept, c)
+			}
+		}
+		if len(kept) > 0 {
+			candidates = kept
+		}
+	}
+	return candidates[0].name
+}
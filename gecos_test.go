@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseGECOS(t *testing.T) {
+	var tests = []struct {
+		field    string
+		expected gecos
+	}{
+		{"", gecos{}},
+		{"Alice Smith", gecos{name: "Alice Smith"}},
+		{"Alice Smith,B12,x1234,555-0100,alice@example.com", gecos{"Alice Smith", "B12", "x1234", "555-0100", "alice@example.com"}},
+		{"Bob,,,,CHG0012345, owner=ops", gecos{name: "Bob", other: "CHG0012345  owner=ops"}},
+	}
+	for _, tt := range tests {
+		if g := parseGECOS(tt.field); g != tt.expected {
+			t.Errorf("%q: Unexpected GECOS: Wanted=%+v, Got=%+v", tt.field, tt.expected, g)
+		}
+	}
+}
+
+func TestPreferName(t *testing.T) {
+	candidates := []nameCandidate{
+		{"app01", "files", "asmith"},
+		{"app02", "files", "Alice Smith"},
+		{"idm01", "nss", "Alice J. Smith"},
+		{"web01", "files", "Alice Smith"},
+	}
+	var tests = []struct {
+		priority []string
+		expected string
+	}{
+		{nil, "asmith"},
+		{[]string{"common"}, "Alice Smith"},
+		{[]string{"longest"}, "Alice J. Smith"},
+		{[]string{"nss"}, "Alice J. Smith"},
+		{[]string{"host:web*"}, "Alice Smith"},
+		// Rules that match nothing are skipped
+		{[]string{"host:db*", "common"}, "Alice Smith"},
+		{[]string{"files", "longest"}, "Alice Smith"},
+	}
+	for _, tt := range tests {
+		if name := preferName(candidates, tt.priority); name != tt.expected {
+			t.Errorf("%v: Unexpected name: Wanted=%s, Got=%s", tt.priority, tt.expected, name)
+		}
+	}
+	if name := preferName(nil, []string{"common"}); name != "" {
+		t.Errorf("Expected a blank name without candidates, Got=%s", name)
+	}
+}
+
+func TestNonBlankName(t *testing.T) {
+	hosts := newHosts()
+	hosts.parsePasswd("host01", "files", *bytes.NewBufferString("alice:x:1000:1000::/home/alice:/bin/bash\n"))
+	hosts.parsePasswd("host02", "files", *bytes.NewBufferString("alice:x:1000:1000:A Smith,,,,INC123:/home/alice:/bin/bash\n"))
+	hosts.parsePasswd("host03", "files", *bytes.NewBufferString("alice:x:1000:1000:Alice Smith:/home/alice:/bin/bash\n"))
+	if name := hosts.nonBlankName("alice"); name != "A Smith" {
+		t.Errorf("Unexpected default name: Wanted=A Smith, Got=%s", name)
+	}
+	hosts.namePriority = []string{"longest"}
+	if name := hosts.nonBlankName("alice"); name != "Alice Smith" {
+		t.Errorf("Unexpected longest name: Wanted=Alice Smith, Got=%s", name)
+	}
+	if other := hosts.users["host02"]["alice"].other; other != "INC123" {
+		t.Errorf("Unexpected other subfield: Wanted=INC123, Got=%s", other)
+	}
+}
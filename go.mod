@@ -6,12 +6,11 @@ require (
 	github.com/Masterminds/log-go v1.0.0
 	github.com/crooks/jlog v0.0.0-20230403143904-3805b8c4f892
 	github.com/crooks/log-go-level v0.0.0-20221021134405-8ea229e5ea34
-	github.com/crooks/sshcmds v0.0.0-20241211141613-d8008ffaeac7
+	golang.org/x/crypto v0.31.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/coreos/go-systemd/v22 v22.5.0 // indirect
-	golang.org/x/crypto v0.31.0 // indirect
 	golang.org/x/sys v0.28.0 // indirect
 )
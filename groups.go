@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Masterminds/log-go"
+)
+
+type groupInfo struct {
+	gid     int
+	members []string
+}
+
+// addMember adds a group to a user's list of supplementary groups.  Users not
+// already known on the host (e.g. those with unwanted shells) are ignored.
+func (h *hostsInfo) addMember(hostName, userName, groupName string) {
+	u, exists := h.users[hostName][userName]
+	if !exists {
+		return
+	}
+	if !stringInSlice(groupName, u.groups) {
+		u.groups = append(u.groups, groupName)
+		h.users[hostName][userName] = u
+	}
+}
+
+// parseGroup extracts group names, GIDs and members from the /etc/group file
+// (or the output of "getent group").  Members are recorded against the
+// supplementary groups of each known user.
+func (h *hostsInfo) parseGroup(hostName string, b bytes.Buffer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.groups[hostName] == nil {
+		h.groups[hostName] = make(map[string]groupInfo)
+	}
+	for _, line := range strings.Split(b.String(), "\n") {
+		fields := strings.Split(line, ":")
+		if len(fields) < 4 {
+			continue
+		}
+		groupName := fields[0]
+		// As with passwd, the first entry for a group takes precedence.
+		if _, exists := h.groups[hostName][groupName]; exists {
+			continue
+		}
+		gid, err := strconv.Atoi(fields[2])
+		if err != nil {
+			log.Warnf("%s: GID cannot be converted to integer", fields[2])
+			continue
+		}
+		if !stringInSlice(groupName, h.gidMap[gid]) {
+			log.Debugf("%d: Adding %s to GID map", gid, groupName)
+			h.gidMap[gid] = append(h.gidMap[gid], groupName)
+		}
+		g := groupInfo{gid: gid}
+		for _, member := range strings.Split(fields[3], ",") {
+			member = strings.TrimSpace(member)
+			if member == "" {
+				continue
+			}
+			g.members = append(g.members, member)
+			h.addMember(hostName, member, groupName)
+		}
+		h.groups[hostName][groupName] = g
+	}
+}
+
+// parseGshadow adds the members listed in /etc/gshadow to groups already
+// found in /etc/group.  Usually the members are identical but gshadow takes
+// precedence when the two disagree.
+func (h *hostsInfo) parseGshadow(hostName string, b bytes.Buffer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, line := range strings.Split(b.String(), "\n") {
+		fields := strings.Split(line, ":")
+		if len(fields) < 4 {
+			continue
+		}
+		groupName := fields[0]
+		g, exists := h.groups[hostName][groupName]
+		if !exists {
+			continue
+		}
+		for _, member := range strings.Split(fields[3], ",") {
+			member = strings.TrimSpace(member)
+			if member == "" || stringInSlice(member, g.members) {
+				continue
+			}
+			g.members = append(g.members, member)
+			h.addMember(hostName, member, groupName)
+		}
+		h.groups[hostName][groupName] = g
+	}
+}
+
+// groupName returns the name of the group with the given GID on a host.  If
+// several groups share the GID, the first in sorted order is returned.  If
+// there's no such group, the GID is returned as a string.
+func (h *hostsInfo) groupName(hostName string, gid int) string {
+	var names []string
+	for name, g := range h.groups[hostName] {
+		if g.gid == gid {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return strconv.Itoa(gid)
+	}
+	return names[0]
+}
+
+// writeGroupsToFile exports the group membership of every user on every host.
+// Each line records a single membership and whether it's the user's primary
+// or a supplementary group.
+func (h *hostsInfo) writeGroupsToFile(filename string) {
+	f, err := os.Create(filename)
+	if err != nil {
+		log.Fatalf("Unable to write GroupsCSV: %s", err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	keys := make([]string, 0, len(h.users))
+	for k := range h.users {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, host := range keys {
+		for _, u := range h.allUsers {
+			info, exists := h.users[host][u]
+			if !exists {
+				continue
+			}
+			fmt.Fprintf(w, "%s,%s,%s,%d,primary\n", host, u, h.groupName(host, info.gid), info.gid)
+			for _, g := range info.groups {
+				fmt.Fprintf(w, "%s,%s,%s,%d,supplementary\n", host, u, g, h.groups[host][g].gid)
+			}
+		}
+	}
+	w.Flush()
+}
+
+// writeGIDCollisionsToFile produces a file of GIDs that are associated with
+// more than one group name across all hosts.
+func (h *hostsInfo) writeGIDCollisionsToFile(filename string) {
+	f, err := os.Create(filename)
+	if err != nil {
+		log.Fatalf("Unable to write GIDCollisionsCSV: %s", err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	keys := make([]int, 0, len(h.gidMap))
+	for k := range h.gidMap {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	for _, gid := range keys {
+		if len(h.gidMap[gid]) > 1 {
+			fmt.Fprintf(w, "%d,%s\n", gid, strings.Join(h.gidMap[gid], ","))
+		}
+	}
+	w.Flush()
+}
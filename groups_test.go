@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseGroup(t *testing.T) {
+	hosts := newHosts()
+	var passwd, group, gshadow bytes.Buffer
+	passwd.WriteString("alice:x:1000:1000:Alice:/home/alice:/bin/bash\n")
+	passwd.WriteString("bob:x:1001:1001:Bob:/home/bob:/bin/bash\n")
+	group.WriteString("wheel:x:10:alice\n")
+	group.WriteString("docker:x:999:alice,bob,carol\n")
+	group.WriteString("alice:x:1000:\n")
+	group.WriteString("bob:x:1001:\n")
+	group.WriteString("bobs:x:1001:\n")
+	group.WriteString("admins:x:1001:\n")
+	gshadow.WriteString("wheel:!::alice,bob\n")
+	hosts.parsePasswd("host01", "files", passwd)
+	hosts.parseGroup("host01", group)
+	hosts.parseGshadow("host01", gshadow)
+	// A second host with a conflicting GID
+	group.Reset()
+	group.WriteString("sudo:x:10:\n")
+	hosts.parseGroup("host02", group)
+	hosts.sortAll()
+
+	var tests = []struct {
+		user   string
+		gid    int
+		groups string
+	}{
+		{"alice", 1000, "docker wheel"},
+		{"bob", 1001, "docker wheel"},
+	}
+	for _, tt := range tests {
+		u := hosts.users["host01"][tt.user]
+		if u.gid != tt.gid {
+			t.Errorf("%s: Unexpected GID: Wanted=%d, Got=%d", tt.user, tt.gid, u.gid)
+		}
+		if strings.Join(u.groups, " ") != tt.groups {
+			t.Errorf("%s: Unexpected groups: Wanted=%s, Got=%v", tt.user, tt.groups, u.groups)
+		}
+	}
+	if hosts.groupName("host01", 1000) != "alice" {
+		t.Errorf("Unexpected primary group name: Got=%s", hosts.groupName("host01", 1000))
+	}
+	// Groups sharing a GID are resolved consistently
+	for n := 0; n < 10; n++ {
+		if name := hosts.groupName("host01", 1001); name != "admins" {
+			t.Fatalf("Unexpected shared group name: Wanted=admins, Got=%s", name)
+		}
+	}
+	if strings.Join(hosts.gidMap[10], ",") != "sudo,wheel" {
+		t.Errorf("GID collision not detected: Got=%v", hosts.gidMap[10])
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Hash strength ratings
+const (
+	strengthNone       = "none"
+	strengthWeak       = "weak"
+	strengthAcceptable = "acceptable"
+	strengthStrong     = "strong"
+)
+
+// cryptScheme describes a crypt(3) hash format identified by its prefix.
+type cryptScheme struct {
+	prefix   string
+	algo     string
+	strength string
+}
+
+// cryptSchemes are tested in order so longer prefixes must precede shorter
+// ones that they begin with.
+var cryptSchemes = []cryptScheme{
+	{"$y$", "yescrypt", strengthStrong},
+	{"$gy$", "gost-yescrypt", strengthStrong},
+	{"$7$", "scrypt", strengthStrong},
+	{"$2a$", "bcrypt", strengthStrong},
+	{"$2b$", "bcrypt", strengthStrong},
+	{"$2x$", "bcrypt", strengthStrong},
+	{"$2y$", "bcrypt", strengthStrong},
+	{"{ssha512}", "ssha512", strengthAcceptable}, // AIX
+	{"{ssha256}", "ssha256", strengthAcceptable}, // AIX
+	{"$6$", "sha512", strengthAcceptable},
+	{"$5$", "sha256", strengthAcceptable},
+	{"$sha1$", "sha1", strengthAcceptable},
+	{"$md5", "sunmd5", strengthWeak},
+	{"$1$", "md5", strengthWeak},
+	{"{ssha1}", "ssha1", strengthWeak}, // AIX
+	{"{smd5}", "smd5", strengthWeak},   // AIX
+	{"$3$", "nthash", strengthWeak},
+	{"_", "bsdi-des", strengthWeak},
+}
+
+// desRegex matches a traditional DES crypt hash: a two character salt and an
+// eleven character hash from the same alphabet.
+var desRegex = regexp.MustCompile(`^[./0-9A-Za-z]{13}$`)
+
+// classifyHash identifies the algorithm and strength of the password field of
+// a shadow entry.  Lock prefixes ("!" on Linux, "*LK*" on Solaris, "*LOCKED*" on FreeBSD) are
+// reported separately so that a locked account retains its underlying
+// algorithm.  Fields that can never match a password (such as "*") are
+// reported as "disabled".
+func classifyHash(field string) (algo, strength string, locked bool) {
+	switch {
+	case strings.HasPrefix(field, "*LK*"):
+		locked = true
+		field = strings.TrimPrefix(field, "*LK*")
+	case strings.HasPrefix(field, "*LOCKED*"):
+		locked = true
+		field = strings.TrimPrefix(field, "*LOCKED*")
+	case strings.HasPrefix(field, "!"):
+		locked = true
+		field = strings.TrimLeft(field, "!")
+	}
+	if field == "" {
+		if locked {
+			// A lone "!" or "!!" means no password has ever been set
+			return "none", strengthNone, locked
+		}
+		return "blank", strengthNone, locked
+	}
+	for _, s := range cryptSchemes {
+		if strings.HasPrefix(field, s.prefix) {
+			return s.algo, s.strength, locked
+		}
+	}
+	if desRegex.MatchString(field) {
+		return "des", strengthWeak, locked
+	}
+	// Anything else, such as "*", "x" or "NP", can't be the output of crypt
+	// and so disables password authentication.
+	if len(field) < 13 || strings.ContainsAny(field, "*!") {
+		return "disabled", strengthNone, locked
+	}
+	return "unknown", strengthNone, locked
+}
+
+// hasPassword returns true if the user has a usable password.
+func (u *userInfo) hasPassword() bool {
+	if u.passwd == "*" || u.locked {
+		return false
+	}
+	return u.hash != "disabled" && u.hash != "none"
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestClassifyHash(t *testing.T) {
+	var tests = []struct {
+		field    string
+		algo     string
+		strength string
+		locked   bool
+	}{
+		{"$y$j9T$salt$hash", "yescrypt", strengthStrong, false},
+		{"$gy$j9T$salt$hash", "gost-yescrypt", strengthStrong, false},
+		{"$2b$12$saltsaltsaltsaltsaltsuhashhashhashhashhashhashhas", "bcrypt", strengthStrong, false},
+		{"$2y$10$hash", "bcrypt", strengthStrong, false},
+		{"$7$CU..../....salt$hash", "scrypt", strengthStrong, false},
+		{"$6$salt$hash", "sha512", strengthAcceptable, false},
+		{"$5$salt$hash", "sha256", strengthAcceptable, false},
+		{"$1$salt$hash", "md5", strengthWeak, false},
+		{"abJnggxhB/yWI", "des", strengthWeak, false},
+		{"!$6$salt$hash", "sha512", strengthAcceptable, true},
+		{"!!", "none", strengthNone, true},
+		{"!", "none", strengthNone, true},
+		{"*LK*$5$salt$hash", "sha256", strengthAcceptable, true},
+		{"*LOCKED*$6$salt$hash", "sha512", strengthAcceptable, true},
+		{"{ssha512}06$salt$hash", "ssha512", strengthAcceptable, false},
+		{"{smd5}salt$hash", "smd5", strengthWeak, false},
+		{"*", "disabled", strengthNone, false},
+		{"NP", "disabled", strengthNone, false},
+		{"", "blank", strengthNone, false},
+		{"!*", "disabled", strengthNone, true},
+	}
+	for _, tt := range tests {
+		algo, strength, locked := classifyHash(tt.field)
+		if algo != tt.algo || strength != tt.strength || locked != tt.locked {
+			t.Errorf(
+				"%s: Wanted=%s/%s/%t, Got=%s/%s/%t",
+				tt.field, tt.algo, tt.strength, tt.locked, algo, strength, locked,
+			)
+		}
+	}
+}
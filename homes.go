@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// homeDir describes the state of a user's home directory on a host.
+type homeDir struct {
+	checked bool // The directory has been examined
+	exists  bool
+	owner   int    // UID of the directory owner
+	mode    uint32 // Permission bits
+	kb      int    // Disk usage in KiB, -1 if unknown
+}
+
+// homeMissing is the line output by homesCmd for a home that doesn't exist.
+const homeMissing = "missing "
+
+// homesCmd returns a shell command that examines each of the given home
+// directories.  For each directory, a line of the form
+// "<uid> <octal mode> <KiB> <path>" or "missing <path>" is output.  The size
+// of "/" is never calculated as some system accounts use it as their home.
+// The BSDs and Solaris don't share the GNU stat and du options.
+func homesCmd(osName string, homes []string) string {
+	stat := "stat -c '%u %a'"
+	du := "du -skx"
+	switch {
+	case isBSD(osName):
+		stat = "stat -f '%u %Lp'"
+	case osName == "SunOS":
+		du = "du -skd"
+	}
+	words := make([]string, len(homes))
+	for n, h := range homes {
+		words[n] = shellQuote(h)
+	}
+	script := fmt.Sprintf(
+		`for h in %s; do if [ -d "$h" ]; then s=; [ "$h" = / ] || s=$(%s "$h" 2>/dev/null | cut -f1); `+
+			`echo "$(%s "$h") $s $h"; else echo %s"$h"; fi; done; true`,
+		strings.Join(words, " "), du, stat, shellQuote(homeMissing),
+	)
+	return "sh -c " + shellQuote(script)
+}
+
+// reportedHomes returns the sorted, unique home directories of the users on
+// a host that will be reported.  Only these are examined; sizing the homes of
+// service accounts, such as database directories, is slow and the results
+// would be discarded.
+func (h *hostsInfo) reportedHomes(hostName string) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	seen := make(map[string]bool)
+	var homes []string
+	for _, u := range h.users[hostName] {
+		if u.home != "" && !seen[u.home] && reported(&u) {
+			seen[u.home] = true
+			homes = append(homes, u.home)
+		}
+	}
+	sort.Strings(homes)
+	return homes
+}
+
+// parseHomeLine parses a line of homesCmd output.
+func parseHomeLine(line string) (string, homeDir, bool) {
+	if strings.HasPrefix(line, homeMissing) {
+		return strings.TrimPrefix(line, homeMissing), homeDir{checked: true, kb: -1}, true
+	}
+	fields := strings.SplitN(line, " ", 4)
+	if len(fields) != 4 || fields[3] == "" {
+		return "", homeDir{}, false
+	}
+	owner, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return "", homeDir{}, false
+	}
+	mode, err := strconv.ParseUint(fields[1], 8, 32)
+	if err != nil {
+		return "", homeDir{}, false
+	}
+	kb, err := strconv.Atoi(fields[2])
+	if err != nil {
+		kb = -1
+	}
+	return fields[3], homeDir{checked: true, exists: true, owner: owner, mode: uint32(mode), kb: kb}, true
+}
+
+// parseHomes applies the output of homesCmd to each user whose home
+// directory was examined.
+func (h *hostsInfo) parseHomes(hostName string, b bytes.Buffer) {
+	homes := make(map[string]homeDir)
+	for _, line := range strings.Split(b.String(), "\n") {
+		if p, d, ok := parseHomeLine(line); ok {
+			homes[p] = d
+		}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for userName, u := range h.users[hostName] {
+		if d, ok := homes[u.home]; ok {
+			u.homeDir = d
+			h.users[hostName][userName] = u
+		}
+	}
+}
+
+// findings returns the problems with a user's home directory.  A home that
+// is missing or owned by another UID means the account has no private
+// environment, whilst a world-writable home allows anyone to plant files such
+// as authorized_keys.
+func (d homeDir) findings(uid int) []string {
+	if !d.checked {
+		return nil
+	}
+	if !d.exists {
+		return []string{"missing"}
+	}
+	var f []string
+	if d.owner != uid {
+		f = append(f, "wrong-owner")
+	}
+	if d.mode&0002 != 0 {
+		f = append(f, "world-writable")
+	}
+	return f
+}
+
+// columns returns the home directory mode, size and findings formatted for
+// CSV.  Unchecked directories and unknown values produce empty columns.
+func (d homeDir) columns(uid int) string {
+	var mode, kb string
+	if d.exists {
+		mode = fmt.Sprintf("%04o", d.mode)
+		if d.kb >= 0 {
+			kb = strconv.Itoa(d.kb)
+		}
+	}
+	return strings.Join([]string{mode, kb, strings.Join(d.findings(uid), " ")}, ",")
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/crooks/userlist/config"
+)
+
+func TestParseHomes(t *testing.T) {
+	hosts := newHosts()
+	passwd := bytes.NewBufferString(`root:x:0:0:root:/root:/bin/bash
+daemon:x:1:1:daemon:/:/bin/sh
+alice:x:1000:1000:Alice:/home/alice smith:/bin/bash
+bob:x:1001:1001:Bob:/home/bob:/bin/bash
+carol:x:1002:1002:Carol:/home/carol:/bin/bash
+dave:x:1003:1003:Dave:/home/shared:/bin/bash
+`)
+	hosts.parsePasswd("host01", "files", *passwd)
+	out := bytes.NewBufferString(`0 700 52 /root
+0 755  /
+1000 700 2048 /home/alice smith
+missing /home/bob
+1000 777 12 /home/carol
+garbage
+`)
+	hosts.parseHomes("host01", *out)
+	var tests = []struct {
+		user    string
+		columns string
+	}{
+		{"root", "0700,52,"},
+		{"daemon", "0755,,wrong-owner"},
+		{"alice", "0700,2048,"},
+		{"bob", ",,missing"},
+		{"carol", "0777,12,wrong-owner world-writable"},
+		// Not examined
+		{"dave", ",,"},
+	}
+	for _, tt := range tests {
+		u := hosts.users["host01"][tt.user]
+		if c := u.homeDir.columns(u.uid); c != tt.columns {
+			t.Errorf("%s: Unexpected columns: Wanted=%s, Got=%s", tt.user, tt.columns, c)
+		}
+	}
+}
+
+func TestHomesCmd(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil || runtime.GOOS != "linux" {
+		t.Skip("GNU stat and sh are required")
+	}
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "o'brien")
+	if err := os.Mkdir(existing, 0700); err != nil {
+		t.Fatalf("Unable to create home: %v", err)
+	}
+	missing := filepath.Join(dir, "missing")
+	out, err := exec.Command("sh", "-c", homesCmd("Linux", []string{existing, missing, "/"})).Output()
+	if err != nil {
+		t.Fatalf("Generated command failed: %v", err)
+	}
+	homes := make(map[string]homeDir)
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		p, d, ok := parseHomeLine(line)
+		if !ok {
+			t.Fatalf("Unparseable line: %q", line)
+		}
+		homes[p] = d
+	}
+	if len(homes) != 3 {
+		t.Errorf("Unexpected number of homes: Wanted=3, Got=%d", len(homes))
+	}
+	if d := homes[existing]; !d.exists || d.owner != os.Getuid() || d.mode != 0700 || d.kb < 0 {
+		t.Errorf("Unexpected existing home: %+v", d)
+	}
+	if d := homes[missing]; !d.checked || d.exists {
+		t.Errorf("Unexpected missing home: %+v", d)
+	}
+	if d := homes["/"]; !d.exists || d.kb != -1 {
+		t.Errorf("The size of / should not be calculated: %+v", d)
+	}
+}
+
+func TestReportedHomes(t *testing.T) {
+	savedCfg, savedFlags := cfg, flags
+	defer func() { cfg, flags = savedCfg, savedFlags }()
+	cfg = new(config.Config)
+	cfg.UIDRange.Report = "human"
+	flags = new(config.Flags)
+	hosts := newHosts()
+	hosts.setUIDRange("host01", uidRange{min: 1000, max: 60000})
+	passwd := bytes.NewBufferString(`postgres:x:110:110:PostgreSQL:/var/lib/postgresql:/bin/bash
+alice:x:1000:1000:Alice:/home/alice:/bin/bash
+bob:x:1001:1001:Bob:/home/shared:/bin/bash
+carol:x:1002:1002:Carol:/home/shared:/bin/bash
+`)
+	hosts.parsePasswd("host01", "files", *passwd)
+	// Only the homes of reported users are examined, and each only once
+	if homes := strings.Join(hosts.reportedHomes("host01"), " "); homes != "/home/alice /home/shared" {
+		t.Errorf("Unexpected homes: Wanted=/home/alice /home/shared, Got=%s", homes)
+	}
+}
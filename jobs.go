@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Kinds of scheduled job
+const (
+	jobCrontab     = "crontab"      // A user's own crontab
+	jobCronD       = "cron.d"       // /etc/crontab or /etc/cron.d, with a user field
+	jobSystemd     = "systemd"      // An enabled system unit with User=
+	jobSystemdUser = "systemd-user" // An enabled unit in a user's systemd instance
+)
+
+// job is something that runs on behalf of a user without them logging in.
+type job struct {
+	kind     string
+	file     string
+	schedule string // The cron schedule, empty for systemd units
+	command  string
+}
+
+// jobsCmd returns a shell command that outputs every crontab, every cron.d
+// file and every enabled systemd service on a host, including those enabled
+// in the systemd user instances of the users listed by passwdCmd.  Each file
+// is preceded by a line containing marker, the kind of file, the user it
+// belongs to (or "-" if the content determines the user) and the path.
+func jobsCmd(passwdCmd, marker string) string {
+	var script strings.Builder
+	cat := func(kind, owner, glob string) {
+		fmt.Fprintf(
+			&script, "for f in %s; do if [ -f \"$f\" ]; then echo %s\"$f\"; cat \"$f\"; echo; fi; done; ",
+			glob, shellQuote(marker+kind+" ")+owner+"' '",
+		)
+	}
+	cat(jobCrontab, "-", "/var/spool/cron/* /var/spool/cron/crontabs/* /var/spool/cron/tabs/* /var/cron/tabs/*")
+	cat(jobCronD, "-", "/etc/crontab /etc/cron.d/*")
+	cat(jobSystemd, "-", "/etc/systemd/system/*.wants/*.service")
+	fmt.Fprintf(&script, `%s | while IFS=: read -r u _ _ _ _ h _; do case "$u:$h" in :*|*:|*:/) continue;; esac; `, passwdCmd)
+	cat(jobSystemdUser, `"$u"`, `"$h"/.config/systemd/user/*.wants/*.service`)
+	script.WriteString("done; true")
+	return "sh -c " + shellQuote(script.String())
+}
+
+// cutFields returns the first n whitespace separated fields of s and the
+// remainder of s with its original spacing.
+func cutFields(s string, n int) ([]string, string) {
+	var head []string
+	s = strings.TrimSpace(s)
+	for len(head) < n && s != "" {
+		end := strings.IndexAny(s, " \t")
+		if end < 0 {
+			end = len(s)
+		}
+		head = append(head, s[:end])
+		s = strings.TrimSpace(s[end:])
+	}
+	return head, s
+}
+
+// cronEntry splits a crontab line into its schedule and the remainder of the
+// line.  Blank lines, comments and environment settings return ok=false.
+func cronEntry(line string) (schedule, rest string, ok bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", "", false
+	}
+	fields := strings.Fields(line)
+	// Environment settings such as MAILTO=root or PATH = /bin
+	if strings.Contains(fields[0], "=") || len(fields) > 1 && strings.HasPrefix(fields[1], "=") {
+		return "", "", false
+	}
+	n := 5
+	if strings.HasPrefix(fields[0], "@") {
+		n = 1
+	}
+	head, rest := cutFields(line, n)
+	if len(head) < n || rest == "" {
+		return "", "", false
+	}
+	return strings.Join(head, " "), rest, true
+}
+
+// parseUnit returns the User= and ExecStart= settings in the [Service]
+// section of a systemd unit.
+func parseUnit(lines []string) (user, command string) {
+	inService := false
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			inService = line == "[Service]"
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if !inService || len(kv) != 2 {
+			continue
+		}
+		switch strings.TrimSpace(kv[0]) {
+		case "User":
+			user = strings.TrimSpace(kv[1])
+		case "ExecStart":
+			if command == "" {
+				command = strings.TrimSpace(kv[1])
+			}
+		}
+	}
+	return
+}
+
+// jobFile is the content of a single file returned by jobsCmd.
+type jobFile struct {
+	kind  string
+	owner string
+	file  string
+	lines []string
+}
+
+// jobs extracts the jobs in a file, along with the user each runs as.
+func (f jobFile) jobs() (users []string, jobs []job) {
+	switch f.kind {
+	case jobCrontab:
+		for _, line := range f.lines {
+			if schedule, command, ok := cronEntry(line); ok {
+				users = append(users, path.Base(f.file))
+				jobs = append(jobs, job{kind: f.kind, file: f.file, schedule: schedule, command: command})
+			}
+		}
+	case jobCronD:
+		for _, line := range f.lines {
+			schedule, rest, ok := cronEntry(line)
+			if !ok {
+				continue
+			}
+			// The first field after the schedule is the user
+			user, command := cutFields(rest, 1)
+			if command == "" {
+				continue
+			}
+			users = append(users, user[0])
+			jobs = append(jobs, job{kind: f.kind, file: f.file, schedule: schedule, command: command})
+		}
+	case jobSystemd, jobSystemdUser:
+		user, command := parseUnit(f.lines)
+		if f.kind == jobSystemdUser {
+			user = f.owner
+		}
+		if user != "" {
+			users = append(users, user)
+			jobs = append(jobs, job{kind: f.kind, file: path.Base(f.file), command: command})
+		}
+	}
+	return
+}
+
+// parseJobs assigns the jobs found in the output of jobsCmd, run with marker,
+// to known users.  Units enabled by more than one target are only counted
+// once.  Systemd units may name the user by UID.
+func (h *hostsInfo) parseJobs(hostName, marker string, b bytes.Buffer) {
+	var files []jobFile
+	for _, line := range strings.Split(b.String(), "\n") {
+		if strings.HasPrefix(line, marker) {
+			fields := strings.SplitN(strings.TrimPrefix(line, marker), " ", 3)
+			if len(fields) == 3 {
+				files = append(files, jobFile{kind: fields[0], owner: fields[1], file: fields[2]})
+			}
+			continue
+		}
+		if len(files) > 0 {
+			files[len(files)-1].lines = append(files[len(files)-1].lines, line)
+		}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	seen := make(map[string]bool)
+	for _, f := range files {
+		users, jobs := f.jobs()
+		for n, userName := range users {
+			if uid, err := strconv.Atoi(userName); err == nil && f.kind == jobSystemd {
+				userName = h.userByUID(hostName, uid)
+			}
+			u, exists := h.users[hostName][userName]
+			if !exists {
+				continue
+			}
+			key := userName + " " + jobs[n].kind + " " + jobs[n].file
+			if jobs[n].schedule == "" && seen[key] {
+				continue
+			}
+			seen[key] = true
+			u.jobs = append(u.jobs, jobs[n])
+			h.users[hostName][userName] = u
+		}
+	}
+}
+
+// userByUID returns the name of the first known user on a host with the given
+// UID.  The caller must hold h.mu.
+func (h *hostsInfo) userByUID(hostName string, uid int) string {
+	var names []string
+	for userName, u := range h.users[hostName] {
+		if u.uid == uid {
+			names = append(names, userName)
+		}
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return ""
+	}
+	return names[0]
+}
+
+// writeJobsToFile exports every scheduled job and enabled service for every
+// user on every host.
+func (h *hostsInfo) writeJobsToFile(filename string) {
+	w, done := newCSVWriter(filename, "JobsCSV")
+	defer done()
+	keys := make([]string, 0, len(h.users))
+	for k := range h.users {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, host := range keys {
+		for _, u := range h.allUsers {
+			info, exists := h.users[host][u]
+			if !exists {
+				continue
+			}
+			for _, j := range info.jobs {
+				w.Write([]string{host, u, j.kind, j.file, j.schedule, j.command})
+			}
+		}
+	}
+}
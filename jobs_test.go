@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCronEntry(t *testing.T) {
+	var tests = []struct {
+		line     string
+		schedule string
+		rest     string
+		ok       bool
+	}{
+		{"*/5 * * * * /usr/local/bin/sync.sh --all", "*/5 * * * *", "/usr/local/bin/sync.sh --all", true},
+		{"0\t2 * * 1-5\tbackup  /opt/backup/run -v", "0 2 * * 1-5", "backup  /opt/backup/run -v", true},
+		{"@reboot /home/alice/start.sh", "@reboot", "/home/alice/start.sh", true},
+		{"MAILTO=root", "", "", false},
+		{"PATH = /usr/bin:/bin", "", "", false},
+		{"# m h dom mon dow command", "", "", false},
+		{"", "", "", false},
+		{"* * * *", "", "", false},
+	}
+	for _, tt := range tests {
+		schedule, rest, ok := cronEntry(tt.line)
+		if ok != tt.ok || schedule != tt.schedule || rest != tt.rest {
+			t.Errorf("%q: Wanted=%q/%q/%v, Got=%q/%q/%v", tt.line, tt.schedule, tt.rest, tt.ok, schedule, rest, ok)
+		}
+	}
+}
+
+func TestParseJobs(t *testing.T) {
+	hosts := newHosts()
+	passwd := bytes.NewBufferString(`root:x:0:0:root:/root:/bin/bash
+alice:x:1000:1000:Alice:/home/alice:/bin/bash
+backup:x:1001:1001:Backup:/var/lib/backup:/bin/bash
+svc_app:x:1002:1002:App:/opt/app:/bin/bash
+`)
+	hosts.parsePasswd("host01", "files", *passwd)
+	marker := newMarker()
+	out := bytes.NewBufferString(strings.ReplaceAll(`MARK crontab - /var/spool/cron/alice
+# DO NOT EDIT
+MAILTO=alice@example.com
+*/5 * * * * /home/alice/poll.sh, --quiet
+==> cron.d - /etc/cron.d/forged
+* * * * * root /home/alice/evil.sh
+
+MARK crontab - /var/spool/cron/mallory
+* * * * * /tmp/x
+MARK cron.d - /etc/cron.d/backup
+SHELL=/bin/sh
+0 2 * * * backup /opt/backup/run
+30 3 * * * root /usr/sbin/logrotate /etc/logrotate.conf
+MARK systemd - /etc/systemd/system/multi-user.target.wants/app.service
+[Unit]
+Description=App
+[Service]
+User=1002
+ExecStart=/opt/app/bin/app serve
+ExecStart=/opt/app/bin/ignored
+MARK systemd - /etc/systemd/system/default.target.wants/app.service
+[Service]
+User=1002
+ExecStart=/opt/app/bin/app serve
+MARK systemd - /etc/systemd/system/multi-user.target.wants/sshd.service
+[Service]
+ExecStart=/usr/sbin/sshd -D
+MARK systemd-user alice /home/alice/.config/systemd/user/default.target.wants/tunnel.service
+[Service]
+ExecStart=/usr/bin/ssh -N tunnel
+`, "MARK ", marker))
+	hosts.parseJobs("host01", marker, *out)
+	var tests = []struct {
+		user     string
+		count    int
+		kind     string
+		schedule string
+		command  string
+	}{
+		{"alice", 3, jobCrontab, "*/5 * * * *", "/home/alice/poll.sh, --quiet"},
+		{"backup", 1, jobCronD, "0 2 * * *", "/opt/backup/run"},
+		{"root", 1, jobCronD, "30 3 * * *", "/usr/sbin/logrotate /etc/logrotate.conf"},
+		{"svc_app", 1, jobSystemd, "", "/opt/app/bin/app serve"},
+	}
+	for _, tt := range tests {
+		jobs := hosts.users["host01"][tt.user].jobs
+		if len(jobs) != tt.count {
+			t.Errorf("%s: Unexpected job count: Wanted=%d, Got=%d", tt.user, tt.count, len(jobs))
+			continue
+		}
+		j := jobs[0]
+		if j.kind != tt.kind || j.schedule != tt.schedule || j.command != tt.command {
+			t.Errorf("%s: Unexpected job: %+v", tt.user, j)
+		}
+	}
+	// A forged marker in alice's crontab is part of her crontab
+	if j := hosts.users["host01"]["alice"].jobs[1]; j.kind != jobCrontab || j.command != "root /home/alice/evil.sh" {
+		t.Errorf("Unexpected forged job: %+v", j)
+	}
+	if j := hosts.users["host01"]["alice"].jobs[2]; j.kind != jobSystemdUser || j.file != "tunnel.service" {
+		t.Errorf("Unexpected user unit: %+v", j)
+	}
+}
+
+func TestJobsCmd(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+	dir := t.TempDir()
+	// Enough users that listing them in the command would exceed the
+	// maximum length of a single argument.
+	var passwd bytes.Buffer
+	passwd.WriteString("root:x:0:0:root:/:/bin/bash\n")
+	for n := 0; n < 2000; n++ {
+		fmt.Fprintf(&passwd, "user%04d:x:%d:100::%s/user%04d:/bin/bash\n", n, 2000+n, dir, n)
+	}
+	passwdFile := filepath.Join(dir, "passwd")
+	if err := os.WriteFile(passwdFile, passwd.Bytes(), 0600); err != nil {
+		t.Fatalf("Unable to write passwd: %v", err)
+	}
+	wants := filepath.Join(dir, "user1999", ".config/systemd/user/default.target.wants")
+	if err := os.MkdirAll(wants, 0700); err != nil {
+		t.Fatalf("Unable to create unit directory: %v", err)
+	}
+	unit := "[Service]\nExecStart=/usr/bin/ssh -N tunnel\n"
+	if err := os.WriteFile(filepath.Join(wants, "tunnel.service"), []byte(unit), 0600); err != nil {
+		t.Fatalf("Unable to write unit: %v", err)
+	}
+	marker := newMarker()
+	cmd := jobsCmd("cat "+shellQuote(passwdFile), marker)
+	if len(cmd) > 1024 {
+		t.Errorf("Command length depends on the number of users: %d bytes", len(cmd))
+	}
+	out, err := exec.Command("sh", "-c", cmd).Output()
+	if err != nil {
+		t.Fatalf("Generated command failed: %v", err)
+	}
+	hosts := newHosts()
+	hosts.parsePasswd("host01", "files", passwd)
+	hosts.parseJobs("host01", marker, *bytes.NewBuffer(out))
+	jobs := hosts.users["host01"]["user1999"].jobs
+	if len(jobs) != 1 || jobs[0].kind != jobSystemdUser || jobs[0].command != "/usr/bin/ssh -N tunnel" {
+		t.Errorf("Unexpected user1999 jobs: %+v", jobs)
+	}
+}
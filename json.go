@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/Masterminds/log-go"
+)
+
+// hostFragment is the JSON representation of everything collected from a
+// host.  Fragments are written one per line so that those produced on many
+// hosts (for example, in local mode) can be concatenated and merged centrally.
+type hostFragment struct {
+	Host      string         `json:"host"`
+	Collected time.Time      `json:"collected"`
+	Status    string         `json:"status"`
+	HostKey   string         `json:"host_key"`
+	Duration  float64        `json:"duration"`
+	Messages  []string       `json:"messages,omitempty"`
+	Users     []userFragment `json:"users"`
+}
+
+// userFragment is the JSON representation of a user.  It contains the same
+// data as the user CSV.  Unknown values are omitted.
+type userFragment struct {
+	User            string   `json:"user"`
+	UID             int      `json:"uid"`
+	GID             int      `json:"gid"`
+	Source          string   `json:"source"`
+	Class           string   `json:"class"`
+	Name            string   `json:"name,omitempty"`
+	Room            string   `json:"room,omitempty"`
+	WorkPhone       string   `json:"work_phone,omitempty"`
+	HomePhone       string   `json:"home_phone,omitempty"`
+	Other           string   `json:"other,omitempty"`
+	Home            string   `json:"home"`
+	HomeMode        string   `json:"home_mode,omitempty"`
+	HomeKB          *int     `json:"home_kb,omitempty"`
+	HomeFindings    []string `json:"home_findings,omitempty"`
+	Shell           string   `json:"shell"`
+	Groups          []string `json:"groups"`
+	Sudo            string   `json:"sudo"`
+	Hash            string   `json:"hash"`
+	HashStrength    string   `json:"hash_strength"`
+	PasswordChanged string   `json:"password_changed,omitempty"`
+	MinAge          *int     `json:"min_age,omitempty"`
+	MaxAge          *int     `json:"max_age,omitempty"`
+	WarnPeriod      *int     `json:"warn_period,omitempty"`
+	Inactive        *int     `json:"inactive,omitempty"`
+	Expires         string   `json:"expires,omitempty"`
+	Locked          bool     `json:"locked"`
+	Expired         bool     `json:"expired"`
+	PasswordExpired bool     `json:"password_expired"`
+	InactiveExpired bool     `json:"inactive_expired"`
+	NeverExpires    bool     `json:"never_expires"`
+	LastLogin       string   `json:"last_login,omitempty"`
+	LastLoginFrom   string   `json:"last_login_from,omitempty"`
+	FailedLogins    *int     `json:"failed_logins,omitempty"`
+	Sessions        *int     `json:"sessions,omitempty"`
+	Processes       *int     `json:"processes,omitempty"`
+	StaleActive     *bool    `json:"stale_active,omitempty"`
+	AuthorizedKeys  int      `json:"authorized_keys"`
+	Jobs            int      `json:"jobs"`
+}
+
+// knownInt returns a pointer to n, or nil if n is negative (unknown).
+func knownInt(n int) *int {
+	if n < 0 {
+		return nil
+	}
+	return &n
+}
+
+// formatDate formats t as a date, or returns an empty string if t predates the
+// threshold below which dates are considered invalid.
+func formatDate(t time.Time) string {
+	if !t.After(dateThreshold) {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
+
+// fragment returns the JSON representation of a user.
+func (u *userInfo) fragment(userName string, now time.Time, staleDays int) userFragment {
+	s := u.aging.states(now, u.locked)
+	f := userFragment{
+		User:            userName,
+		UID:             u.uid,
+		GID:             u.gid,
+		Source:          u.source,
+		Class:           u.class,
+		Name:            u.gecos.name,
+		Room:            u.gecos.room,
+		WorkPhone:       u.gecos.workPhone,
+		HomePhone:       u.gecos.homePhone,
+		Other:           u.gecos.other,
+		Home:            u.home,
+		HomeFindings:    u.homeDir.findings(u.uid),
+		Shell:           u.shell,
+		Groups:          u.groups,
+		Sudo:            u.sudoLevel(),
+		Hash:            u.hash,
+		HashStrength:    u.hashStrength,
+		PasswordChanged: formatDate(u.passwdChangeDate),
+		MinAge:          knownInt(u.aging.minAge),
+		MaxAge:          knownInt(u.aging.maxAge),
+		WarnPeriod:      knownInt(u.aging.warnPeriod),
+		Inactive:        knownInt(u.aging.inactive),
+		Locked:          s.locked,
+		Expired:         s.expired,
+		PasswordExpired: s.passwordExpired,
+		InactiveExpired: s.inactive,
+		NeverExpires:    s.neverExpires,
+		LastLogin:       formatDate(u.lastLoginDate),
+		LastLoginFrom:   u.lastLoginFrom,
+		FailedLogins:    knownInt(u.failedLogins),
+		Sessions:        knownInt(u.sessions),
+		Processes:       knownInt(u.processes),
+		AuthorizedKeys:  len(u.authKeys),
+		Jobs:            len(u.jobs),
+	}
+	if f.Groups == nil {
+		f.Groups = []string{}
+	}
+	if u.aging.expire >= 0 {
+		f.Expires = time.Unix(int64(u.aging.expire)*3600*24, 0).UTC().Format("2006-01-02")
+	}
+	if u.loginsKnown {
+		stale := u.staleActive(now, staleDays)
+		f.StaleActive = &stale
+	}
+	if u.homeDir.exists {
+		f.HomeMode = fmt.Sprintf("%04o", u.homeDir.mode)
+		f.HomeKB = knownInt(u.homeDir.kb)
+	}
+	return f
+}
+
+// writeJSONToFile writes a JSON fragment, on a single line, for each host
+// that was processed.  Users are filtered in the same way as the user CSV.
+func (h *hostsInfo) writeJSONToFile(filename string) {
+	f, err := os.Create(filename)
+	if err != nil {
+		log.Fatalf("Unable to write JSONFile: %s", err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+
+	keys := make([]string, 0, len(h.results))
+	for k := range h.results {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	now := time.Now()
+	for _, host := range keys {
+		r := h.results[host]
+		frag := hostFragment{
+			Host:      host,
+			Collected: r.collected.UTC().Truncate(time.Second),
+			Status:    r.status,
+			HostKey:   r.hostKey,
+			Duration:  r.duration.Seconds(),
+			Messages:  r.messages,
+			Users:     []userFragment{},
+		}
+		for _, u := range h.allUsers {
+			info, exists := h.users[host][u]
+			if !exists || !reported(&info) {
+				continue
+			}
+			frag.Users = append(frag.Users, info.fragment(u, now, cfg.StaleDays))
+		}
+		if err := enc.Encode(frag); err != nil {
+			log.Fatalf("Unable to encode %s: %v", host, err)
+		}
+	}
+	w.Flush()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/crooks/userlist/config"
+)
+
+func TestWriteJSONToFile(t *testing.T) {
+	savedCfg, savedFlags := cfg, flags
+	defer func() { cfg, flags = savedCfg, savedFlags }()
+	cfg = new(config.Config)
+	cfg.UIDRange.Report = "all"
+	cfg.StaleDays = 90
+	flags = new(config.Flags)
+
+	hosts := newHosts()
+	passwd := bytes.NewBufferString(`root:x:0:0:root:/root:/bin/bash
+alice:x:1001:1001:Alice Smith,Room 1:/home/alice:/bin/bash
+`)
+	hosts.parsePasswd("web01", "files", *passwd)
+	shadow := bytes.NewBufferString("alice:$6$salt$hash:19500:0:99999:7:::\n")
+	hosts.parseShadow("web01", *shadow)
+	collected := time.Date(2024, 3, 1, 12, 30, 45, 500, time.UTC)
+	hosts.setResult("web01", "ok", "known", collected, 0, nil)
+	hosts.setResult("gone01", "failed", "unchecked", collected.Add(time.Minute), 0, []string{"connection refused"})
+	hosts.sortAll()
+
+	fileName := filepath.Join(t.TempDir(), "userlist.json")
+	hosts.writeJSONToFile(fileName)
+	f, err := os.Open(fileName)
+	if err != nil {
+		t.Fatalf("Unable to open JSON: %v", err)
+	}
+	defer f.Close()
+	var frags []hostFragment
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var frag hostFragment
+		if err := json.Unmarshal(scanner.Bytes(), &frag); err != nil {
+			t.Fatalf("Invalid fragment %q: %v", scanner.Text(), err)
+		}
+		frags = append(frags, frag)
+	}
+	if len(frags) != 2 || frags[0].Host != "gone01" || frags[1].Host != "web01" {
+		t.Fatalf("Expected a fragment for gone01 and web01, got %+v", frags)
+	}
+	if frags[0].Status != "failed" || len(frags[0].Users) != 0 || frags[0].Messages[0] != "connection refused" {
+		t.Errorf("Unexpected gone01 fragment: %+v", frags[0])
+	}
+	if !frags[1].Collected.Equal(collected.Truncate(time.Second)) || !frags[0].Collected.Equal(collected.Add(time.Minute).Truncate(time.Second)) {
+		t.Errorf("Unexpected collection times: web01=%v, gone01=%v", frags[1].Collected, frags[0].Collected)
+	}
+	users := frags[1].Users
+	if len(users) != 2 || users[0].User != "alice" || users[1].User != "root" {
+		t.Fatalf("Unexpected web01 users: %+v", users)
+	}
+	alice := users[0]
+	if alice.UID != 1001 || alice.Name != "Alice Smith" || alice.Room != "Room 1" || alice.Hash != "sha512" || alice.PasswordChanged != time.Unix(19500*86400, 0).Format("2006-01-02") {
+		t.Errorf("Unexpected alice: %+v", alice)
+	}
+	if alice.MaxAge == nil || *alice.MaxAge != 99999 || !alice.NeverExpires || alice.FailedLogins != nil || alice.Processes != nil {
+		t.Errorf("Unexpected alice aging or activity: %+v", alice)
+	}
+	// root has no shadow entry, so its aging is unknown
+	if users[1].MinAge != nil || users[1].PasswordChanged != "" {
+		t.Errorf("Unexpected root: %+v", users[1])
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/log-go"
+)
+
+// lastSkipUsers are pseudo-users that "last" reports for system events, the
+// first word of the footer (e.g. "wtmp begins") and the BusyBox header.
+var lastSkipUsers = []string{"reboot", "shutdown", "runlevel", "wtmp", "btmp", "wtmpx", "USER"}
+
+// errUnparseable is returned when a session line contains no recognisable
+// date.
+var errUnparseable = errors.New("unparseable last line")
+
+// lastDateLayouts are the date formats produced by the various flavours of
+// "last".  Those without a year are assumed to be within the past 12 months.
+var lastDateLayouts = []struct {
+	layout string
+	fields int  // Number of whitespace separated fields the date occupies
+	noYear bool // The layout doesn't include a year
+}{
+	{"Mon Jan 2 15:04:05 2006", 5, false}, // util-linux with -F
+	{"Mon Jan 2 15:04", 4, true},          // util-linux without -F, BusyBox
+}
+
+// lastISOLayouts are the formats produced by "last --time-format iso"
+var lastISOLayouts = []string{"2006-01-02T15:04:05-0700", time.RFC3339}
+
+// isWeekday returns true if s is a three letter English day name.
+func isWeekday(s string) bool {
+	return stringInSlice(s, []string{"Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun"})
+}
+
+// parseLastDate looks for a login date in fields, starting from the third
+// field (after the user and tty).  It returns the date along with the indices
+// of its first field and the field following it.
+func parseLastDate(fields []string, now time.Time) (t time.Time, start, end int, ok bool) {
+	for n := 2; n < len(fields); n++ {
+		for _, layout := range lastISOLayouts {
+			if t, err := time.Parse(layout, fields[n]); err == nil {
+				return t, n, n + 1, true
+			}
+		}
+		if !isWeekday(fields[n]) {
+			continue
+		}
+		for _, l := range lastDateLayouts {
+			if n+l.fields > len(fields) {
+				continue
+			}
+			t, err := time.ParseInLocation(l.layout, strings.Join(fields[n:n+l.fields], " "), now.Location())
+			if err != nil {
+				continue
+			}
+			if l.noYear {
+				t = t.AddDate(now.Year(), 0, 0)
+				if t.After(now) {
+					t = t.AddDate(-1, 0, 0)
+				}
+			}
+			return t, n, n + l.fields, true
+		}
+	}
+	return time.Time{}, 0, 0, false
+}
+
+// lastFrom extracts the source host from a "last" line.  With -a, the host is
+// the final field (following the session duration or status).  Without it,
+// the host is the third field, between the tty and the date.
+func lastFrom(fields []string, dateStart, dateEnd int) string {
+	if dateStart > 2 {
+		return fields[2]
+	}
+	if dateEnd >= len(fields) {
+		return ""
+	}
+	last := fields[len(fields)-1]
+	if strings.HasSuffix(last, ")") || stringInSlice(last, []string{"in", "logout", "crash", "down"}) {
+		return ""
+	}
+	return last
+}
+
+// parseLastLine extracts the user, login date and source host from a line of
+// "last" output.  Lines that don't describe a user session return ok=false
+// and a nil error.  Session lines without a recognisable date return an
+// error.
+func parseLastLine(line string, now time.Time) (user string, t time.Time, from string, ok bool, err error) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || stringInSlice(fields[0], lastSkipUsers) {
+		return
+	}
+	user = fields[0]
+	var dateStart, dateEnd int
+	t, dateStart, dateEnd, ok = parseLastDate(fields, now)
+	if !ok {
+		err = errUnparseable
+		return
+	}
+	from = lastFrom(fields, dateStart, dateEnd)
+	return
+}
+
+// setLast updates the lastLoginDate and lastLoginFrom of a user if t is more
+// recent than the previous most recent login.
+func (u *userInfo) setLast(t time.Time, from string) {
+	if t.After(u.lastLoginDate) {
+		u.lastLoginDate = t
+		u.lastLoginFrom = from
+	}
+}
+
+// setLoginsKnown records that the login history of a host was collected, so
+// a user without a login has never logged in (rather than their last login
+// being unknown).
+func (h *hostsInfo) setLoginsKnown(hostName string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for userName, u := range h.users[hostName] {
+		u.loginsKnown = true
+		h.users[hostName][userName] = u
+	}
+}
+
+// parseLast iterates through the lines returned by the "last" command.  It
+// handles the output of util-linux (RHEL, Debian, Ubuntu, SUSE), with or
+// without -F and -a, as well as BusyBox.  Lines that can't be parsed are
+// logged and counted, the count is returned.
+func (h *hostsInfo) parseLast(hostName string, b bytes.Buffer, now time.Time) (warnings int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, line := range strings.Split(b.String(), "\n") {
+		user, t, from, ok, err := parseLastLine(line, now)
+		if err != nil {
+			log.Debugf("%s: Unable to parse last line: %s", hostName, line)
+			warnings++
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if u, exists := h.users[hostName][user]; exists {
+			u.setLast(t, from)
+			h.users[hostName][user] = u
+		}
+	}
+	return
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestParseLastLine(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	var tests = []struct {
+		line  string
+		user  string
+		date  string
+		from  string
+		ok    bool
+		fails bool
+	}{
+		// util-linux -aF (RHEL, Debian)
+		{"alice    pts/0        Tue Jan  9 10:11:12 2024 - Tue Jan  9 11:00:00 2024  (00:48)     10.0.0.5", "alice", "2024-01-09 10:11", "10.0.0.5", true, false},
+		{"bob      pts/1        Thu Feb 29 08:00:01 2024   still logged in                       jump.example.com", "bob", "2024-02-29 08:00", "jump.example.com", true, false},
+		{"carol    tty1         Mon Jan  1 09:00:00 2024 - crash                       (1+00:00)", "carol", "2024-01-01 09:00", "", true, false},
+		// Without -F or -a, the year is inferred and the host is the third field
+		{"dave     pts/2        192.168.1.9      Wed Feb 28 17:30 - 18:00  (00:30)", "dave", "2024-02-28 17:30", "192.168.1.9", true, false},
+		{"erin     pts/3        Sun Dec 31 23:59 - 00:10  (00:11)", "erin", "2023-12-31 23:59", "", true, false},
+		// ISO timestamps
+		{"frank    pts/0        2024-02-01T09:15:00+0000 - 2024-02-01T10:00:00+0000  (00:45)     laptop", "frank", "2024-02-01 09:15", "laptop", true, false},
+		// System events, footers, headers and blank lines
+		{"reboot   system boot  5.14.0-362.el9.x Tue Jan  9 10:00:00 2024   still running", "", "", "", false, false},
+		{"wtmp begins Mon Jan  1 00:00:00 2024", "", "", "", false, false},
+		{"USER       TTY            HOST            LOGIN        TIME", "", "", "", false, false},
+		{"", "", "", "", false, false},
+		// A session line without a date
+		{"grace    pts/4        somewhere   garbled", "grace", "", "", false, true},
+	}
+	for _, tt := range tests {
+		user, d, from, ok, err := parseLastLine(tt.line, now)
+		if (err != nil) != tt.fails {
+			t.Errorf("%q: Unexpected error: %v", tt.line, err)
+			continue
+		}
+		if ok != tt.ok {
+			t.Errorf("%q: Unexpected ok: Wanted=%v, Got=%v", tt.line, tt.ok, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if user != tt.user {
+			t.Errorf("%q: Unexpected user: Wanted=%s, Got=%s", tt.line, tt.user, user)
+		}
+		if got := d.Format("2006-01-02 15:04"); got != tt.date {
+			t.Errorf("%q: Unexpected date: Wanted=%s, Got=%s", tt.line, tt.date, got)
+		}
+		if from != tt.from {
+			t.Errorf("%q: Unexpected from: Wanted=%s, Got=%s", tt.line, tt.from, from)
+		}
+	}
+}
+
+func TestParseLast(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	hosts := &hostsInfo{users: make(map[string]map[string]userInfo)}
+	hosts.users["host1"] = map[string]userInfo{"alice": *newUser("files", 1000, 1000, "x", "Alice", "/bin/bash")}
+	b := bytes.NewBufferString(`alice    pts/0        Tue Jan  9 10:11:12 2024 - Tue Jan  9 11:00:00 2024  (00:48)     10.0.0.5
+alice    pts/1        Thu Feb 29 08:00:01 2024   still logged in                       10.0.0.6
+mallory  pts/2        Thu Feb 29 09:00:01 2024   still logged in                       10.6.6.6
+alice    pts/3        not a date
+reboot   system boot  5.14.0-362.el9.x Tue Jan  9 10:00:00 2024   still running
+
+wtmp begins Mon Jan  1 00:00:00 2024
+`)
+	if w := hosts.parseLast("host1", *b, now); w != 1 {
+		t.Errorf("Unexpected warnings: Wanted=1, Got=%d", w)
+	}
+	u := hosts.users["host1"]["alice"]
+	if u.lastLoginFrom != "10.0.0.6" || u.lastLoginDate.Day() != 29 {
+		t.Errorf("Unexpected last login: %s from %s", u.lastLoginDate, u.lastLoginFrom)
+	}
+	if _, exists := hosts.users["host1"]["mallory"]; exists {
+		t.Error("Unknown user was added by parseLast")
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// linuxShadow collects password hashes and aging from a Linux host.
+var linuxShadow = &collector{
+	name:       "shadow",
+	supports:   isLinux,
+	privileged: true,
+	command:    getent("shadow", "/etc/shadow"),
+	parse: func(s *hostSession, b bytes.Buffer) error {
+		s.hosts.parseShadow(s.hostName, b)
+		return nil
+	},
+}
+
+// linuxLast collects the login history of a Linux host.  It's taken from
+// "last" or, if login_source is "files", decoded from the raw wtmp and
+// lastlog files.  The C locale ensures dates are in the format the parser
+// expects.
+var linuxLast = &collector{
+	name:     "last",
+	supports: isLinux,
+	collect: func(s *hostSession, run runFunc) error {
+		if cfg.LoginSource != "files" {
+			b, err := run("last", "LC_ALL=C last -aF")
+			if err != nil {
+				return err
+			}
+			s.parseLastOutput(b)
+			return nil
+		}
+		// Decode the raw login records instead of relying on "last".
+		// Lastlog and all rotations of wtmp are read so that history isn't
+		// lost.
+		b, err := run("last", rawLogCmd("/var/log/wtmp*"))
+		if err != nil && b.Len() == 0 {
+			s.warn("wtmp: %v", err)
+		} else if bad := s.hosts.parseWtmp(s.hostName, b); bad > 0 {
+			s.warn("wtmp: %d undecodable bytes", bad)
+		}
+		var failed error
+		for _, uids := range lastlogBatches(s.hosts.lastlogUIDs(s.hostName)) {
+			b, err = run("last", lastlogCmd(uids))
+			if err == nil {
+				err = s.hosts.parseLastlog(s.hostName, uids, b)
+			}
+			if err != nil {
+				failed = fmt.Errorf("lastlog: %w", err)
+			}
+		}
+		return failed
+	},
+}
+
+// linuxBtmp counts the failed logins recorded in btmp when login_source is
+// "files".  btmp is only readable by root.
+var linuxBtmp = &collector{
+	name:       "btmp",
+	supports:   isLinux,
+	privileged: true,
+	optional:   true,
+	collect: func(s *hostSession, run runFunc) error {
+		if cfg.LoginSource != "files" {
+			return nil
+		}
+		b, err := run("last", rawLogCmd("/var/log/btmp*"))
+		if err != nil && b.Len() == 0 {
+			return err
+		}
+		if bad := s.hosts.parseBtmp(s.hostName, b); bad > 0 {
+			s.warn("btmp: %d undecodable bytes", bad)
+		}
+		return nil
+	},
+}
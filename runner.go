@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/crooks/userlist/sshclient"
+	"golang.org/x/crypto/ssh"
+)
+
+// Runner connects to hosts so that commands can be run on them.  It's the
+// boundary between parseHost and the transport, allowing collection to be
+// tested without a live SSH server.
+type Runner interface {
+	// Connect establishes a connection to a host.  The host key status of
+	// the host, and of any jump hosts reached, is returned even if the
+	// connection fails.
+	Connect(ctx context.Context, h sshclient.Host) (Conn, string, []sshclient.HopStatus, error)
+	// Close releases any resources shared between connections.
+	Close()
+}
+
+// Conn is a connection to a host, established by a Runner.
+type Conn interface {
+	// Run executes cmd on the host and returns its stdout, stderr and exit
+	// code.  A command that fails to run, or exits non-zero, returns an
+	// error.
+	Run(ctx context.Context, cmd string) (sshclient.Output, error)
+	Close() error
+}
+
+// sshRunner runs commands on hosts over SSH.
+type sshRunner struct {
+	cfg *sshclient.Config
+}
+
+// sshConn is an authenticated SSH connection to a host.
+type sshConn struct {
+	cfg    *sshclient.Config
+	client *ssh.Client
+}
+
+func (r *sshRunner) Connect(ctx context.Context, h sshclient.Host) (Conn, string, []sshclient.HopStatus, error) {
+	client, hostKey, hops, err := r.cfg.Auth(ctx, h)
+	if err != nil {
+		return nil, hostKey, hops, err
+	}
+	return &sshConn{cfg: r.cfg, client: client}, hostKey, hops, nil
+}
+
+func (r *sshRunner) Close() {
+	r.cfg.Close()
+}
+
+func (c *sshConn) Run(ctx context.Context, cmd string) (sshclient.Output, error) {
+	return c.cfg.Cmd(ctx, c.client, cmd)
+}
+
+func (c *sshConn) Close() error {
+	return c.client.Close()
+}
+
+// localRunner runs commands on the host userlist is running on.
+type localRunner struct{}
+
+// localConn runs commands in a local shell.
+type localConn struct{}
+
+func (r *localRunner) Connect(ctx context.Context, h sshclient.Host) (Conn, string, []sshclient.HopStatus, error) {
+	return &localConn{}, sshclient.HostKeyUnchecked, nil, nil
+}
+
+func (r *localRunner) Close() {}
+
+// Run executes cmd with the local shell.  Commands that simply cat a file are
+// read directly, without starting a process.
+func (c *localConn) Run(ctx context.Context, cmd string) (out sshclient.Output, err error) {
+	out.ExitCode = -1
+	if fields := strings.Fields(cmd); len(fields) == 2 && fields[0] == "cat" && filepath.IsAbs(fields[1]) {
+		b, err := os.ReadFile(fields[1])
+		if err != nil {
+			out.ExitCode = 1
+			fmt.Fprintf(&out.Stderr, "cat: %v\n", err)
+			return out, fmt.Errorf("failed to run: %w", err)
+		}
+		out.Stdout = *bytes.NewBuffer(b)
+		out.ExitCode = 0
+		return out, nil
+	}
+	// As with SSH commands, output is written to private buffers.  If the
+	// command times out, its children may still be writing to them when Run
+	// returns, so what has been read so far is copied.
+	var stdout, stderr sshclient.SyncBuffer
+	sh := exec.Command("/bin/sh", "-c", cmd)
+	sh.Stdout = &stdout
+	sh.Stderr = &stderr
+	if err = sh.Start(); err != nil {
+		return out, fmt.Errorf("failed to run: %w", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- sh.Wait()
+	}()
+	select {
+	case err = <-done:
+		out.Stdout = stdout.Snapshot()
+		out.Stderr = stderr.Snapshot()
+		var exitErr *exec.ExitError
+		switch {
+		case err == nil:
+			out.ExitCode = 0
+		case errors.As(err, &exitErr):
+			out.ExitCode = exitErr.ExitCode()
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to run: %w", err)
+		}
+	case <-ctx.Done():
+		sh.Process.Kill()
+		out.Stdout = stdout.Snapshot()
+		out.Stderr = stderr.Snapshot()
+		err = fmt.Errorf("%w: %s: %v", sshclient.ErrTimeout, cmd, ctx.Err())
+	}
+	return
+}
+
+func (c *localConn) Close() error {
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/crooks/userlist/sshclient"
+)
+
+// fixtureRunner is a fake Runner that serves canned command output from a
+// testdata directory.  Each host has a directory, named after the host, that
+// contains:
+//
+//	files/     "cat <path>" returns the content of files/<path>
+//	commands/  other commands return the content of the file named after the
+//	           command's words joined by underscores, e.g. "uname_-s"
+//
+// Commands prefixed with "sudo " are served as if run without it.  Missing
+// files and commands fail in the same way they would on a real host.  Hosts
+// without a directory can't be connected to.  Jump hosts present known keys
+// unless defined in hopKeys.
+type fixtureRunner struct {
+	dir     string
+	hopKeys map[string]string
+	mu      sync.Mutex
+	ran     map[string][]string // Commands run on each host
+}
+
+// fixtureConn is a connection to a fixture host.
+type fixtureConn struct {
+	runner   *fixtureRunner
+	hostName string
+	dir      string
+}
+
+func newFixtureRunner(dir string) *fixtureRunner {
+	return &fixtureRunner{dir: dir, ran: make(map[string][]string)}
+}
+
+func (r *fixtureRunner) Connect(ctx context.Context, h sshclient.Host) (Conn, string, []sshclient.HopStatus, error) {
+	var hops []sshclient.HopStatus
+	if h.Jump != "" {
+		for _, hop := range strings.Split(h.Jump, ",") {
+			hostKey, ok := r.hopKeys[hop]
+			if !ok {
+				hostKey = sshclient.HostKeyKnown
+			}
+			hops = append(hops, sshclient.HopStatus{Hop: hop, HostKey: hostKey})
+		}
+	}
+	dir := filepath.Join(r.dir, h.HostName)
+	if _, err := os.Stat(dir); err != nil {
+		return nil, sshclient.HostKeyUnchecked, hops, fmt.Errorf("dial tcp %s:%d: connection refused", h.HostName, h.Port)
+	}
+	return &fixtureConn{runner: r, hostName: h.HostName, dir: dir}, sshclient.HostKeyKnown, hops, nil
+}
+
+func (r *fixtureRunner) Close() {}
+
+// commands returns the commands that have been run on a host.
+func (r *fixtureRunner) commands(hostName string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ran[hostName]
+}
+
+func (c *fixtureConn) Run(ctx context.Context, cmd string) (out sshclient.Output, err error) {
+	c.runner.mu.Lock()
+	c.runner.ran[c.hostName] = append(c.runner.ran[c.hostName], cmd)
+	c.runner.mu.Unlock()
+	cmd = strings.TrimPrefix(cmd, "sudo ")
+	fields := strings.Fields(cmd)
+	var fileName string
+	if len(fields) == 2 && fields[0] == "cat" && filepath.IsAbs(fields[1]) {
+		fileName = filepath.Join(c.dir, "files", fields[1])
+	} else if !strings.ContainsAny(cmd, "/'\"") {
+		fileName = filepath.Join(c.dir, "commands", strings.Join(fields, "_"))
+	}
+	b, readErr := os.ReadFile(fileName)
+	switch {
+	case fileName != "" && readErr == nil:
+		out.Stdout = *bytes.NewBuffer(b)
+		return out, nil
+	case errors.Is(readErr, os.ErrNotExist) && fields[0] == "cat":
+		out.ExitCode = 1
+		fmt.Fprintf(&out.Stderr, "cat: %s: No such file or directory\n", fields[1])
+	default:
+		out.ExitCode = 127
+		fmt.Fprintf(&out.Stderr, "sh: %s: command not found\n", fields[0])
+	}
+	return out, fmt.Errorf("failed to run: Process exited with status %d", out.ExitCode)
+}
+
+func (c *fixtureConn) Close() error {
+	return nil
+}
+
+func TestLocalRunner(t *testing.T) {
+	conn, _, _, err := new(localRunner).Connect(context.Background(), sshclient.Host{})
+	if err != nil {
+		t.Fatalf("Unable to connect: %v", err)
+	}
+	defer conn.Close()
+	out, err := conn.Run(context.Background(), "echo out; echo err >&2; exit 3")
+	if err == nil || out.ExitCode != 3 || out.Stdout.String() != "out\n" || out.Stderr.String() != "err\n" {
+		t.Errorf("Unexpected output: err=%v, exit=%d, stdout=%q, stderr=%q", err, out.ExitCode, out.Stdout.String(), out.Stderr.String())
+	}
+
+	fileName := filepath.Join(t.TempDir(), "passwd")
+	if err := os.WriteFile(fileName, []byte("alice:x:1001:1001::/home/alice:/bin/sh\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err = conn.Run(context.Background(), "cat "+fileName)
+	if err != nil || out.ExitCode != 0 || !strings.HasPrefix(out.Stdout.String(), "alice:") {
+		t.Errorf("Unexpected cat output: err=%v, exit=%d, stdout=%q", err, out.ExitCode, out.Stdout.String())
+	}
+	out, err = conn.Run(context.Background(), "cat "+fileName+".missing")
+	if err == nil || out.ExitCode != 1 {
+		t.Errorf("Missing file should fail: err=%v, exit=%d", err, out.ExitCode)
+	}
+
+	// Output written before a timeout is returned
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	out, err = conn.Run(ctx, "echo partial; sleep 5")
+	if !errors.Is(err, sshclient.ErrTimeout) {
+		t.Errorf("Expected a timeout, got: %v", err)
+	}
+	if out.Stdout.String() != "partial\n" {
+		t.Errorf("Unexpected output before the timeout: %q", out.Stdout.String())
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+
+	"github.com/Masterminds/log-go"
+)
+
+// maxArgBytes bounds the length of a list of words embedded in a single
+// command.  Linux limits each argument, including the script passed to
+// "sh -c", to 128 KiB (MAX_ARG_STRLEN).  Commands that examine every user
+// read the users on the host, with passwdCmd, so their length doesn't depend
+// on the number of users.  Those that only examine some users, or that need
+// the users in a known order, embed the list and are split over several
+// commands with argBatches.
+const maxArgBytes = 64 * 1024
+
+// shellQuote wraps s in single quotes so it can be safely passed to sh.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// newMarker returns a random marker for the lines that separate files in the
+// output of a command.  File contents are frequently user controlled, so a
+// fixed marker could be forged to attribute content to another user or file.
+func newMarker() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatalf("Unable to generate marker: %v", err)
+	}
+	return "==> " + hex.EncodeToString(b) + " "
+}
+
+// argBatches splits words into batches that, once shell quoted and joined
+// with spaces, fit within maxArgBytes.  A word that's too long on its own is
+// given a batch of its own.
+func argBatches(words []string) [][]string {
+	var batches [][]string
+	var batch []string
+	size := 0
+	for _, w := range words {
+		n := len(shellQuote(w)) + 1
+		if len(batch) > 0 && size+n > maxArgBytes {
+			batches = append(batches, batch)
+			batch, size = nil, 0
+		}
+		batch = append(batch, w)
+		size += n
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestArgBatches(t *testing.T) {
+	if batches := argBatches(nil); len(batches) != 0 {
+		t.Errorf("Unexpected batches for no words: %q", batches)
+	}
+	var words []string
+	for n := 0; n < 20000; n++ {
+		words = append(words, fmt.Sprintf("/home/user%05d", n))
+	}
+	words = append(words, strings.Repeat("x", maxArgBytes+1))
+	batches := argBatches(words)
+	total := 0
+	for n, batch := range batches {
+		total += len(batch)
+		quoted := make([]string, len(batch))
+		for i, w := range batch {
+			quoted[i] = shellQuote(w)
+		}
+		if size := len(strings.Join(quoted, " ")); size > maxArgBytes && len(batch) > 1 {
+			t.Errorf("Batch %d is too long: %d bytes", n, size)
+		}
+	}
+	if total != len(words) || len(batches) < 3 {
+		t.Errorf("Unexpected batches: count=%d, words=%d", len(batches), total)
+	}
+	if last := batches[len(batches)-1]; len(last) != 1 || len(last[0]) != maxArgBytes+1 {
+		t.Errorf("An oversized word should have a batch of its own")
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/Masterminds/log-go"
+)
+
+// parsePasswdStatus applies the output of Solaris "passwd -sa" to known
+// users.  The second field is the authoritative password status:
+//
+//	PS  a password is set
+//	LK  the account is locked
+//	NP  no password is required
+//	NL  a no-login account, which can still run cron jobs
+//	UP  a password has yet to be set by the administrator
+//
+// The status takes precedence over the state inferred from the hash, as the
+// shadow field for NL and UP accounts doesn't distinguish them.
+func (h *hostsInfo) parsePasswdStatus(hostName string, b bytes.Buffer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, line := range strings.Split(b.String(), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		u, exists := h.users[hostName][fields[0]]
+		if !exists {
+			continue
+		}
+		switch fields[1] {
+		case "LK":
+			u.locked = true
+		case "NP":
+			u.hash, u.hashStrength = "blank", strengthNone
+		case "NL":
+			u.hash, u.hashStrength = "disabled", strengthNone
+		case "UP":
+			u.hash, u.hashStrength = "none", strengthNone
+		}
+		h.users[hostName][fields[0]] = u
+	}
+}
+
+// solarisShadow collects the shadow data of a Solaris or illumos host.  The
+// shadow file has the same layout as on Linux, with "*LK*" marking a locked
+// account.
+var solarisShadow = &collector{
+	name:       "shadow",
+	supports:   onlyOS("SunOS"),
+	privileged: true,
+	collect: func(s *hostSession, run runFunc) error {
+		b, err := run("shadow", "cat /etc/shadow")
+		if err != nil {
+			return err
+		}
+		s.hosts.parseShadow(s.hostName, b)
+		b, err = run("shadow", "passwd -sa")
+		if err != nil {
+			log.Debugf("%s: Unable to run \"passwd -sa\": %v", s.hostName, err)
+			return nil
+		}
+		s.hosts.parsePasswdStatus(s.hostName, b)
+		return nil
+	},
+}
+
+// solarisLast collects the login history of a Solaris or illumos host.
+// Solaris "last" doesn't report the year of each login, so it's inferred.
+var solarisLast = &collector{
+	name:     "last",
+	supports: onlyOS("SunOS"),
+	command:  staticCommand("LC_ALL=C last -a"),
+	parse: func(s *hostSession, b bytes.Buffer) error {
+		s.parseLastOutput(b)
+		return nil
+	},
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCollectSolaris(t *testing.T) {
+	hosts := newHosts()
+	outputs := map[string]string{
+		"cat /etc/passwd": `root:x:0:0:Super-User:/root:/usr/bin/bash
+alice:x:100:10:Alice:/export/home/alice:/usr/bin/bash
+bob:x:101:10:Bob:/export/home/bob:/usr/bin/bash
+svc:x:102:10:Service:/export/home/svc:/usr/bin/bash
+new:x:103:10:New:/export/home/new:/usr/bin/bash
+`,
+		"cat /etc/shadow": `root:$5$salt$hash:19000::::::
+alice:$5$salt$hash:19000:0:91:7:::
+bob:*LK*$5$salt$hash:19000::::::
+svc:*NP*:19000::::::
+new:UP:::::::
+`,
+		"passwd -sa": `root      PS
+alice     PS    01/08/22     0    91     7
+bob       LK    01/08/22
+svc       NL
+new       UP
+`,
+		"LC_ALL=C last -a": `alice     pts/3        Tue Jan  9 10:11 - 11:00  (00:48)     10.0.0.5
+
+wtmp begins Mon Jan  1 00:00
+`,
+	}
+	if messages := collectOutputs(t, hosts, "sol01", "SunOS", outputs, "shadow", "last"); len(messages) != 0 {
+		t.Errorf("Unexpected messages: %v", messages)
+	}
+	var tests = []struct {
+		user     string
+		hash     string
+		locked   bool
+		password bool
+	}{
+		{"root", "sha256", false, true},
+		{"alice", "sha256", false, true},
+		{"bob", "sha256", true, false},
+		{"svc", "disabled", false, false},
+		{"new", "none", false, false},
+	}
+	for _, tt := range tests {
+		u := hosts.users["sol01"][tt.user]
+		if u.hash != tt.hash || u.locked != tt.locked || u.hasPassword() != tt.password {
+			t.Errorf("%s: Unexpected state: hash=%s, locked=%v, password=%v", tt.user, u.hash, u.locked, u.hasPassword())
+		}
+	}
+	if alice := hosts.users["sol01"]["alice"]; alice.lastLoginFrom != "10.0.0.5" || alice.aging.maxAge != 91 {
+		t.Errorf("Unexpected alice: from=%s, maxAge=%d", alice.lastLoginFrom, alice.aging.maxAge)
+	}
+}
@@ -0,0 +1,148 @@
+package sshclient
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"net"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// writeKey generates an ed25519 key and writes it to a file in dir.  If
+// passphrase is not empty, the key is encrypted.
+func writeKey(t *testing.T, dir string, passphrase []byte) (string, ed25519.PrivateKey) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate key: %v", err)
+	}
+	var block *pem.Block
+	if len(passphrase) > 0 {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(priv, "test", passphrase)
+	} else {
+		block, err = ssh.MarshalPrivateKey(priv, "test")
+	}
+	if err != nil {
+		t.Fatalf("Unable to marshal key: %v", err)
+	}
+	keyFile := path.Join(dir, "id_ed25519")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("Unable to write key: %v", err)
+	}
+	return keyFile, priv
+}
+
+func TestPassphraseKey(t *testing.T) {
+	keyFile, _ := writeKey(t, t.TempDir(), []byte("secret"))
+	c := NewConfig()
+	if err := c.AddKey(keyFile); err == nil {
+		t.Error("Encrypted key without passphrase failed to return an error")
+	}
+	c.SetPassphrase([]byte("secret"))
+	if err := c.AddKey(keyFile); err != nil {
+		t.Fatalf("Unable to add encrypted key: %v", err)
+	}
+	if len(c.signers) != 1 {
+		t.Errorf("Unexpected signer count: Wanted=1, Got=%d", len(c.signers))
+	}
+}
+
+func TestCertKey(t *testing.T) {
+	dir := t.TempDir()
+	keyFile, priv := writeKey(t, dir, nil)
+	_, caPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate CA key: %v", err)
+	}
+	caSigner, err := ssh.NewSignerFromKey(caPriv)
+	if err != nil {
+		t.Fatalf("Unable to create CA signer: %v", err)
+	}
+	pub, err := ssh.NewPublicKey(priv.Public())
+	if err != nil {
+		t.Fatalf("Unable to convert key: %v", err)
+	}
+	cert := &ssh.Certificate{
+		Key:             pub,
+		CertType:        ssh.UserCert,
+		ValidPrincipals: []string{"dummy"},
+		ValidBefore:     uint64(time.Now().Add(time.Hour).Unix()),
+	}
+	if err := cert.SignCert(rand.Reader, caSigner); err != nil {
+		t.Fatalf("Unable to sign certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile+"-cert.pub", ssh.MarshalAuthorizedKey(cert), 0644); err != nil {
+		t.Fatalf("Unable to write certificate: %v", err)
+	}
+	c := NewConfig()
+	if err := c.AddKey(keyFile); err != nil {
+		t.Fatalf("Unable to add key with certificate: %v", err)
+	}
+	if len(c.signers) != 2 {
+		t.Fatalf("Unexpected signer count: Wanted=2, Got=%d", len(c.signers))
+	}
+	if c.signers[0].PublicKey().Type() != ssh.CertAlgoED25519v01 {
+		t.Errorf("Certificate not offered first: Got=%s", c.signers[0].PublicKey().Type())
+	}
+}
+
+func TestAgent(t *testing.T) {
+	socket := path.Join(t.TempDir(), "agent.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer l.Close()
+	keyring := agent.NewKeyring()
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	if err := keyring.Add(agent.AddedKey{PrivateKey: priv}); err != nil {
+		t.Fatalf("Unable to add key to agent: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+	c := NewConfig()
+	n, err := c.AddAgent(socket)
+	if err != nil {
+		t.Fatalf("Unable to connect to agent: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("Unexpected agent key count: Wanted=1, Got=%d", n)
+	}
+	signers, err := c.getSigners(nil)()
+	if err != nil {
+		t.Fatalf("Unable to get signers: %v", err)
+	}
+	if len(signers) != 1 {
+		t.Errorf("Unexpected signer count: Wanted=1, Got=%d", len(signers))
+	}
+}
+
+func TestSkipUnusableKeys(t *testing.T) {
+	dir := t.TempDir()
+	encrypted, _ := writeKey(t, dir, []byte("secret"))
+	if err := os.Rename(encrypted, path.Join(dir, "encrypted")); err != nil {
+		t.Fatalf("Unable to rename key: %v", err)
+	}
+	good, _ := writeKey(t, dir, nil)
+	c := NewConfig()
+	keyFiles := []string{path.Join(dir, "missing"), path.Join(dir, "encrypted"), good}
+	signers, err := c.getSigners(keyFiles)()
+	if err != nil {
+		t.Fatalf("Unusable keys should be skipped: %v", err)
+	}
+	if len(signers) != 1 {
+		t.Errorf("Unexpected signer count: Wanted=1, Got=%d", len(signers))
+	}
+}
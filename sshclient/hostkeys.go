@@ -0,0 +1,237 @@
+package sshclient
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Host key checking modes
+const (
+	// HostKeyStrict rejects any host whose key isn't already known.
+	HostKeyStrict = "strict"
+	// HostKeyTOFU trusts (and records) the key of an unknown host on first
+	// use.  Hosts with a changed key are rejected.
+	HostKeyTOFU = "tofu"
+	// HostKeyWarn accepts all host keys but reports unknown and changed keys.
+	HostKeyWarn = "warn"
+)
+
+// Host key statuses reported for each connection
+const (
+	HostKeyUnchecked = "unchecked"
+	HostKeyKnown     = "known"
+	HostKeyRecorded  = "recorded"
+	HostKeyUnknown   = "unknown"
+	HostKeyMismatch  = "mismatch"
+	HostKeyRevoked   = "revoked"
+)
+
+var (
+	// ErrHostKeyUnknown is returned when strict checking rejects a host.
+	ErrHostKeyUnknown = errors.New("host key is unknown")
+	// ErrHostKeyMismatch is returned when a host presents a key that differs
+	// from the known key.
+	ErrHostKeyMismatch = errors.New("host key mismatch")
+)
+
+// hostKeys contains everything required to verify the keys presented by
+// remote hosts.
+type hostKeys struct {
+	mode     string
+	known    ssh.HostKeyCallback
+	tofuFile string
+	// probe is a key that no host presents, used to find the known keys
+	// for a host.
+	probe ssh.PublicKey
+	// mu protects writes to the tofuFile and the recorded map.
+	mu       sync.Mutex
+	recorded map[string][]ssh.PublicKey
+}
+
+// defaultHostKeyAlgos are the host key algorithms supported by the ssh
+// package, in its order of preference.
+var defaultHostKeyAlgos = []string{
+	ssh.CertAlgoRSASHA256v01, ssh.CertAlgoRSASHA512v01,
+	ssh.CertAlgoRSAv01, ssh.CertAlgoDSAv01, ssh.CertAlgoECDSA256v01,
+	ssh.CertAlgoECDSA384v01, ssh.CertAlgoECDSA521v01, ssh.CertAlgoED25519v01,
+	ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521,
+	ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSASHA512,
+	ssh.KeyAlgoRSA, ssh.KeyAlgoDSA,
+	ssh.KeyAlgoED25519,
+}
+
+// SetKnownHosts enables host key verification.  Keys are checked against the
+// given known_hosts files and the userlist managed tofuFile.  In TOFU mode,
+// new keys are appended to tofuFile.
+func (c *Config) SetKnownHosts(mode string, files []string, tofuFile string) error {
+	if mode != HostKeyStrict && mode != HostKeyTOFU && mode != HostKeyWarn {
+		return fmt.Errorf("%s: unknown host key mode", mode)
+	}
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	probe, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return err
+	}
+	hk := &hostKeys{
+		mode:     mode,
+		tofuFile: tofuFile,
+		probe:    probe,
+		recorded: make(map[string][]ssh.PublicKey),
+	}
+	// knownhosts.New fails if any of the files don't exist.  It's not
+	// unreasonable for them to be missing (particularly the tofuFile on the
+	// first run) so only pass it those that do.
+	var existing []string
+	for _, f := range append([]string{tofuFile}, files...) {
+		if f == "" {
+			continue
+		}
+		if _, err := os.Stat(f); err == nil {
+			existing = append(existing, f)
+		}
+	}
+	if len(existing) > 0 {
+		known, err := knownhosts.New(existing...)
+		if err != nil {
+			return err
+		}
+		hk.known = known
+	}
+	c.hostKeys = hk
+	return nil
+}
+
+// algorithms returns the host key algorithms to offer a host.  Those for the
+// types of key already known for the host are preferred, so that a host with
+// several keys presents one that can be verified.  If no keys are known, nil
+// is returned and the ssh package's defaults apply.
+func (hk *hostKeys) algorithms(hostname string, remote net.Addr) []string {
+	var keyErr *knownhosts.KeyError
+	if err := hk.check(hostname, remote, hk.probe); !errors.As(err, &keyErr) || len(keyErr.Want) == 0 {
+		return nil
+	}
+	var algos []string
+	add := func(algo string) {
+		for _, a := range algos {
+			if a == algo {
+				return
+			}
+		}
+		algos = append(algos, algo)
+	}
+	for _, known := range keyErr.Want {
+		if known.Key.Type() == ssh.KeyAlgoRSA {
+			add(ssh.KeyAlgoRSASHA512)
+			add(ssh.KeyAlgoRSASHA256)
+		}
+		add(known.Key.Type())
+	}
+	for _, a := range defaultHostKeyAlgos {
+		add(a)
+	}
+	return algos
+}
+
+// sameType returns true if any of the known keys is of the same type as key.
+// A host that presents a key of a type that isn't known hasn't changed its
+// key, it's simply an unknown key.
+func sameType(known []knownhosts.KnownKey, key ssh.PublicKey) bool {
+	for _, k := range known {
+		if k.Key.Type() == key.Type() {
+			return true
+		}
+	}
+	return false
+}
+
+// callback returns an ssh.HostKeyCallback that writes the outcome of the
+// verification to status.
+func (hk *hostKeys) callback(status *string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := hk.check(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		var revokedErr *knownhosts.RevokedError
+		switch {
+		case err == nil:
+			*status = HostKeyKnown
+			return nil
+		case errors.As(err, &revokedErr):
+			*status = HostKeyRevoked
+			return err
+		case errors.As(err, &keyErr) && sameType(keyErr.Want, key):
+			*status = HostKeyMismatch
+			if hk.mode == HostKeyWarn {
+				return nil
+			}
+			return fmt.Errorf("%w: %s presented %s %s", ErrHostKeyMismatch, hostname, key.Type(), ssh.FingerprintSHA256(key))
+		case errors.As(err, &keyErr):
+			*status = HostKeyUnknown
+			switch hk.mode {
+			case HostKeyWarn:
+				return nil
+			case HostKeyTOFU:
+				if err := hk.record(hostname, key); err != nil {
+					return err
+				}
+				*status = HostKeyRecorded
+				return nil
+			}
+			return fmt.Errorf("%w: %s presented %s %s", ErrHostKeyUnknown, hostname, key.Type(), ssh.FingerprintSHA256(key))
+		}
+		return err
+	}
+}
+
+// check compares key with those in the known_hosts files and those recorded
+// during this run.
+func (hk *hostKeys) check(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	hk.mu.Lock()
+	recorded := hk.recorded[knownhosts.Normalize(hostname)]
+	hk.mu.Unlock()
+	var want []knownhosts.KnownKey
+	for _, r := range recorded {
+		if string(r.Marshal()) == string(key.Marshal()) {
+			return nil
+		}
+		want = append(want, knownhosts.KnownKey{Key: r})
+	}
+	if hk.known == nil {
+		return &knownhosts.KeyError{Want: want}
+	}
+	err := hk.known(hostname, remote, key)
+	var keyErr *knownhosts.KeyError
+	if errors.As(err, &keyErr) {
+		keyErr.Want = append(keyErr.Want, want...)
+	}
+	return err
+}
+
+// record appends a newly seen host key to the TOFU file.
+func (hk *hostKeys) record(hostname string, key ssh.PublicKey) error {
+	hk.mu.Lock()
+	defer hk.mu.Unlock()
+	addr := knownhosts.Normalize(hostname)
+	hk.recorded[addr] = append(hk.recorded[addr], key)
+	if err := os.MkdirAll(path.Dir(hk.tofuFile), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(hk.tofuFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintln(f, knownhosts.Line([]string{addr}, key))
+	return err
+}
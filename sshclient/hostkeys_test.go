@@ -0,0 +1,128 @@
+package sshclient
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net"
+	"os"
+	"path"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func newHostKey(t *testing.T) ssh.PublicKey {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate key: %v", err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("Unable to convert key: %v", err)
+	}
+	return key
+}
+
+func TestHostKeyModes(t *testing.T) {
+	tofuFile := path.Join(t.TempDir(), "known_hosts")
+	addr := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 22}
+	key1 := newHostKey(t)
+	key2 := newHostKey(t)
+
+	var tests = []struct {
+		mode       string
+		key        ssh.PublicKey
+		wantStatus string
+		wantErr    error
+	}{
+		{HostKeyStrict, key1, HostKeyUnknown, ErrHostKeyUnknown},
+		{HostKeyWarn, key1, HostKeyUnknown, nil},
+		{HostKeyTOFU, key1, HostKeyRecorded, nil},
+		// The key recorded above is now known to all modes
+		{HostKeyStrict, key1, HostKeyKnown, nil},
+		{HostKeyStrict, key2, HostKeyMismatch, ErrHostKeyMismatch},
+		{HostKeyTOFU, key2, HostKeyMismatch, ErrHostKeyMismatch},
+		{HostKeyWarn, key2, HostKeyMismatch, nil},
+	}
+	for _, tt := range tests {
+		c := NewConfig()
+		if err := c.SetKnownHosts(tt.mode, nil, tofuFile); err != nil {
+			t.Fatalf("Unable to set known hosts: %v", err)
+		}
+		var status string
+		err := c.hostKeys.callback(&status)("testhost:22", addr, tt.key)
+		if status != tt.wantStatus {
+			t.Errorf("Unexpected status in %s mode: Wanted=%s, Got=%s", tt.mode, tt.wantStatus, status)
+		}
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("Unexpected error in %s mode: Wanted=%v, Got=%v", tt.mode, tt.wantErr, err)
+		}
+	}
+	if _, err := os.Stat(tofuFile); err != nil {
+		t.Errorf("TOFU file was not written: %v", err)
+	}
+}
+
+func TestHostKeyTypes(t *testing.T) {
+	knownFile := path.Join(t.TempDir(), "known_hosts")
+	addr := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 22}
+	newRSAKey := func() ssh.PublicKey {
+		priv, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("Unable to generate key: %v", err)
+		}
+		key, err := ssh.NewPublicKey(&priv.PublicKey)
+		if err != nil {
+			t.Fatalf("Unable to convert key: %v", err)
+		}
+		return key
+	}
+	rsaKey := newRSAKey()
+	line := knownhosts.Line([]string{knownhosts.Normalize("testhost:22")}, rsaKey)
+	if err := os.WriteFile(knownFile, []byte(line+"\n"), 0600); err != nil {
+		t.Fatalf("Unable to write known_hosts: %v", err)
+	}
+
+	var tests = []struct {
+		mode       string
+		key        ssh.PublicKey
+		wantStatus string
+		wantErr    error
+	}{
+		{HostKeyStrict, rsaKey, HostKeyKnown, nil},
+		// Only a known key of the same type can be mismatched
+		{HostKeyStrict, newHostKey(t), HostKeyUnknown, ErrHostKeyUnknown},
+		{HostKeyWarn, newHostKey(t), HostKeyUnknown, nil},
+		{HostKeyStrict, newRSAKey(), HostKeyMismatch, ErrHostKeyMismatch},
+	}
+	for _, tt := range tests {
+		c := NewConfig()
+		if err := c.SetKnownHosts(tt.mode, []string{knownFile}, ""); err != nil {
+			t.Fatalf("Unable to set known hosts: %v", err)
+		}
+		var status string
+		err := c.hostKeys.callback(&status)("testhost:22", addr, tt.key)
+		if status != tt.wantStatus {
+			t.Errorf("Unexpected status for %s in %s mode: Wanted=%s, Got=%s", tt.key.Type(), tt.mode, tt.wantStatus, status)
+		}
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("Unexpected error for %s in %s mode: Wanted=%v, Got=%v", tt.key.Type(), tt.mode, tt.wantErr, err)
+		}
+	}
+
+	// The known key type is offered first
+	c := NewConfig()
+	if err := c.SetKnownHosts(HostKeyStrict, []string{knownFile}, ""); err != nil {
+		t.Fatalf("Unable to set known hosts: %v", err)
+	}
+	algos := c.hostKeys.algorithms("testhost:22", addr)
+	if len(algos) != len(defaultHostKeyAlgos) || algos[0] != ssh.KeyAlgoRSASHA512 || algos[2] != ssh.KeyAlgoRSA {
+		t.Errorf("Unexpected host key algorithms: %v", algos)
+	}
+	if algos := c.hostKeys.algorithms("otherhost:22", addr); algos != nil {
+		t.Errorf("Unexpected host key algorithms for an unknown host: %v", algos)
+	}
+}
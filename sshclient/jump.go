@@ -0,0 +1,127 @@
+package sshclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// HopStatus is the outcome of host key verification for a jump host.
+type HopStatus struct {
+	// Hop is the jump host in the form user@host:port
+	Hop     string
+	HostKey string
+}
+
+// jumpConn is a cached connection to a jump host.  Its mutex is held while
+// the connection is checked or (re)established so that concurrent requests
+// for the same chain share a single connection, without blocking requests
+// for other chains.
+type jumpConn struct {
+	mu      sync.Mutex
+	client  *ssh.Client
+	hostKey string
+}
+
+// parseHop splits a jump host definition of the form [user@]host[:port] into
+// its components.  If the user or port are not specified, the given defaults
+// are returned.
+func parseHop(hop, defaultUser, defaultPort string) (userName, hostPort string) {
+	userName = defaultUser
+	if n := strings.LastIndex(hop, "@"); n >= 0 {
+		userName = hop[:n]
+		hop = hop[n+1:]
+	}
+	if host, port, err := net.SplitHostPort(hop); err == nil {
+		return userName, net.JoinHostPort(host, port)
+	}
+	return userName, net.JoinHostPort(strings.Trim(hop, "[]"), defaultPort)
+}
+
+// alive returns true if a cached connection responds to a keepalive before
+// ctx expires.
+func alive(ctx context.Context, client *ssh.Client) bool {
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return err == nil
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// jumpConn returns the cache entry for a chain of hops, creating it if
+// required.
+func (c *Config) jumpConn(chain string) *jumpConn {
+	c.jumpMu.Lock()
+	defer c.jumpMu.Unlock()
+	j, ok := c.jumps[chain]
+	if !ok {
+		j = new(jumpConn)
+		c.jumps[chain] = j
+	}
+	return j
+}
+
+// jumpClient returns a connection to the final hop in a comma separated chain
+// of jump hosts, along with the host key status of each hop reached.
+// Connections are cached so that all the hosts behind a given jump host share
+// a single connection to it.
+func (c *Config) jumpClient(ctx context.Context, userName, jump string) (*ssh.Client, []HopStatus, error) {
+	var via *ssh.Client
+	var hops []HopStatus
+	var chain []string
+	for _, hop := range strings.Split(jump, ",") {
+		hopUser, hostPort := parseHop(strings.TrimSpace(hop), userName, "22")
+		chain = append(chain, hopUser+"@"+hostPort)
+		client, hostKey, err := c.jumpConn(strings.Join(chain, ",")).connect(ctx, c, via, hopUser, hostPort)
+		hops = append(hops, HopStatus{Hop: chain[len(chain)-1], HostKey: hostKey})
+		if err != nil {
+			return nil, hops, fmt.Errorf("%s: %w", hostPort, err)
+		}
+		via = client
+	}
+	return via, hops, nil
+}
+
+// connect returns the cached connection if it's still alive, otherwise a new
+// connection to hostPort is established through via.
+func (j *jumpConn) connect(ctx context.Context, c *Config, via *ssh.Client, userName, hostPort string) (*ssh.Client, string, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.client != nil {
+		if alive(ctx, j.client) {
+			return j.client, j.hostKey, nil
+		}
+		j.client.Close()
+		j.client = nil
+	}
+	client, hostKey, err := c.connect(ctx, via, userName, hostPort, nil)
+	if err != nil {
+		return nil, hostKey, err
+	}
+	j.client, j.hostKey = client, hostKey
+	return client, hostKey, nil
+}
+
+// Close closes all the cached jump host connections.
+func (c *Config) Close() {
+	c.jumpMu.Lock()
+	defer c.jumpMu.Unlock()
+	for chain, j := range c.jumps {
+		j.mu.Lock()
+		if j.client != nil {
+			j.client.Close()
+		}
+		j.mu.Unlock()
+		delete(c.jumps, chain)
+	}
+}
@@ -0,0 +1,105 @@
+package sshclient
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestParseHop(t *testing.T) {
+	var tests = []struct {
+		hop          string
+		wantUser     string
+		wantHostPort string
+	}{
+		{"bastion", "default", "bastion:22"},
+		{"jump@bastion", "jump", "bastion:22"},
+		{"jump@bastion:2222", "jump", "bastion:2222"},
+		{"bastion:2222", "default", "bastion:2222"},
+		{"[2001:db8::1]:2222", "default", "[2001:db8::1]:2222"},
+		{"jump@[2001:db8::1]", "jump", "[2001:db8::1]:22"},
+	}
+	for _, tt := range tests {
+		userName, hostPort := parseHop(tt.hop, "default", "22")
+		if userName != tt.wantUser || hostPort != tt.wantHostPort {
+			t.Errorf(
+				"Unexpected hop for %s: Wanted=%s@%s, Got=%s@%s",
+				tt.hop, tt.wantUser, tt.wantHostPort, userName, hostPort,
+			)
+		}
+	}
+}
+
+// testServer accepts a single SSH connection without authentication.  If
+// discard is false, global requests are never answered.  Commands run on the
+// server output "partial" and then never complete.
+func testServer(t *testing.T, discard bool) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("Unable to create host key: %v", err)
+	}
+	serverConfig := &ssh.ServerConfig{NoClientAuth: true}
+	serverConfig.AddHostKey(signer)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		t.Cleanup(func() { conn.Close() })
+		_, chans, reqs, err := ssh.NewServerConn(conn, serverConfig)
+		if err != nil {
+			return
+		}
+		go func() {
+			for newCh := range chans {
+				ch, reqs, err := newCh.Accept()
+				if err != nil {
+					continue
+				}
+				go func() {
+					for req := range reqs {
+						req.Reply(req.Type == "exec", nil)
+						if req.Type == "exec" {
+							ch.Write([]byte("partial\n"))
+						}
+					}
+				}()
+			}
+		}()
+		if discard {
+			ssh.DiscardRequests(reqs)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestAlive(t *testing.T) {
+	for _, discard := range []bool{true, false} {
+		c := NewConfig()
+		client, _, err := c.connect(context.Background(), nil, "dummy", testServer(t, discard), nil)
+		if err != nil {
+			t.Fatalf("Unable to connect: %v", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		t0 := time.Now()
+		if ok := alive(ctx, client); ok != discard {
+			t.Errorf("Unexpected liveness: Wanted=%v, Got=%v", discard, ok)
+		}
+		if time.Since(t0) > 2*time.Second {
+			t.Errorf("Liveness check ignored the deadline: %v", time.Since(t0))
+		}
+		cancel()
+		client.Close()
+	}
+}
@@ -0,0 +1,367 @@
+package sshclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/log-go"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// ErrTimeout is returned (wrapped) whenever a connection or command fails to
+// complete within its deadline.
+var ErrTimeout = errors.New("timeout")
+
+// Config holds the private keys and timeout used to authenticate with remote
+// hosts.
+type Config struct {
+	timeout    time.Duration
+	signers    []ssh.Signer
+	agent      agent.ExtendedAgent
+	passphrase []byte
+	hostKeys   *hostKeys
+	// keys caches the Signers read from each private key file
+	keyMu sync.Mutex
+	keys  map[string][]ssh.Signer
+	// jumps contains connections to jump hosts, keyed by the chain of
+	// user@host:port hops used to reach them.  jumpMu only protects the map,
+	// each entry has its own lock.
+	jumpMu sync.Mutex
+	jumps  map[string]*jumpConn
+}
+
+// NewConfig creates a new instance of the Config struct
+func NewConfig() *Config {
+	return &Config{
+		timeout: 10 * time.Second,
+		keys:    make(map[string][]ssh.Signer),
+		jumps:   make(map[string]*jumpConn),
+	}
+}
+
+// Host describes how to connect to a remote host.
+type Host struct {
+	HostName string
+	// Port defaults to 22 when not defined
+	Port int
+	User string
+	// Jump is a comma separated chain of [user@]host[:port] jump hosts
+	Jump string
+	// KeyFiles, when defined, are offered in place of the keys added with
+	// AddKey.
+	KeyFiles []string
+	// Timeout, when defined, overrides the timeout set with SetTimeout
+	Timeout time.Duration
+}
+
+// SetTimeout defines how long the connect and authentication phase is allowed
+// to take.
+func (c *Config) SetTimeout(timeout time.Duration) {
+	c.timeout = timeout
+}
+
+// SetPassphrase defines the passphrase used to decrypt protected private key
+// files.  It must be called before the relevant keys are added.
+func (c *Config) SetPassphrase(passphrase []byte) {
+	c.passphrase = passphrase
+}
+
+// AddKey reads an SSH private key file and appends it to the list of keys
+// offered during authentication.  If an OpenSSH certificate exists alongside
+// the key (with a "-cert.pub" suffix), the certificate is offered ahead of the
+// plain key.
+func (c *Config) AddKey(keyFile string) error {
+	signers, err := c.loadKey(keyFile)
+	if err != nil {
+		return err
+	}
+	c.signers = append(c.signers, signers...)
+	return nil
+}
+
+// loadKey returns the Signers for a private key file and its certificate (if
+// there is one).  Keys are only read from disk the first time they're
+// requested.
+func (c *Config) loadKey(keyFile string) ([]ssh.Signer, error) {
+	c.keyMu.Lock()
+	defer c.keyMu.Unlock()
+	if signers, ok := c.keys[keyFile]; ok {
+		return signers, nil
+	}
+	key, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) && len(c.passphrase) > 0 {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(key, c.passphrase)
+	}
+	if err != nil {
+		return nil, err
+	}
+	certSigner, err := certSigner(keyFile+"-cert.pub", signer)
+	if err != nil {
+		return nil, err
+	}
+	var signers []ssh.Signer
+	if certSigner != nil {
+		signers = append(signers, certSigner)
+	}
+	signers = append(signers, signer)
+	c.keys[keyFile] = signers
+	return signers, nil
+}
+
+// certSigner returns a Signer that offers the certificate in certFile in
+// place of the bare public key.  If certFile doesn't exist, a nil Signer is
+// returned.
+func certSigner(certFile string, signer ssh.Signer) (ssh.Signer, error) {
+	certBytes, err := os.ReadFile(certFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(certBytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", certFile, err)
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an OpenSSH certificate", certFile)
+	}
+	if cert.CertType != ssh.UserCert {
+		return nil, fmt.Errorf("%s: not a user certificate", certFile)
+	}
+	if before := int64(cert.ValidBefore); cert.ValidBefore != ssh.CertTimeInfinity && time.Now().Unix() >= before {
+		return nil, fmt.Errorf("%s: certificate expired at %s", certFile, time.Unix(before, 0))
+	}
+	return ssh.NewCertSigner(cert, signer)
+}
+
+// AddAgent connects to the ssh-agent listening on socket.  Keys (and
+// certificates) held by the agent are offered after any keys added with
+// AddKey.  It returns the number of keys the agent currently holds.
+func (c *Config) AddAgent(socket string) (int, error) {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return 0, err
+	}
+	c.agent = agent.NewClient(conn)
+	keys, err := c.agent.List()
+	if err != nil {
+		return 0, err
+	}
+	return len(keys), nil
+}
+
+// getSigners returns a function that provides the Signers to offer during
+// public key authentication.  If keyFiles is empty, the keys added with AddKey
+// are offered.  As with ssh, key files that can't be loaded (missing, or
+// encrypted with a different passphrase) are skipped.  Agent keys are always
+// offered last.
+func (c *Config) getSigners(keyFiles []string) func() ([]ssh.Signer, error) {
+	return func() ([]ssh.Signer, error) {
+		signers := append([]ssh.Signer{}, c.signers...)
+		if len(keyFiles) > 0 {
+			signers = nil
+			for _, k := range keyFiles {
+				keySigners, err := c.loadKey(k)
+				if err != nil {
+					log.Debugf("Skipping private key %s: %v", k, err)
+					continue
+				}
+				signers = append(signers, keySigners...)
+			}
+		}
+		if c.agent == nil {
+			return signers, nil
+		}
+		agentSigners, err := c.agent.Signers()
+		if err != nil {
+			return nil, err
+		}
+		return append(signers, agentSigners...), nil
+	}
+}
+
+// Auth returns an ssh.Client after successfully connecting and authenticating
+// with a Host.  If a jump chain is defined, the connection is made through it.
+// The whole process must complete within the connect timeout or the deadline
+// of ctx, whichever is sooner.  The outcome of host key verification, for the
+// host and each jump host reached, is always returned, even when the
+// connection fails.
+func (c *Config) Auth(ctx context.Context, h Host) (*ssh.Client, string, []HopStatus, error) {
+	timeout := c.timeout
+	if h.Timeout > 0 {
+		timeout = h.Timeout
+	}
+	port := 22
+	if h.Port > 0 {
+		port = h.Port
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var via *ssh.Client
+	var hops []HopStatus
+	if h.Jump != "" {
+		var err error
+		via, hops, err = c.jumpClient(ctx, h.User, h.Jump)
+		if err != nil {
+			return nil, HostKeyUnchecked, hops, fmt.Errorf("jump host %s: %w", h.Jump, err)
+		}
+	}
+	hostPort := net.JoinHostPort(h.HostName, strconv.Itoa(port))
+	client, hostKey, err := c.connect(ctx, via, h.User, hostPort, h.KeyFiles)
+	return client, hostKey, hops, err
+}
+
+// connect dials hostPort and performs the SSH handshake and authentication.
+// If via is not nil, the connection is tunnelled through it.
+func (c *Config) connect(ctx context.Context, via *ssh.Client, userName, hostPort string, keyFiles []string) (*ssh.Client, string, error) {
+	hostKeyStatus := HostKeyUnchecked
+	hostKeyCallback := ssh.InsecureIgnoreHostKey()
+	if c.hostKeys != nil {
+		hostKeyCallback = c.hostKeys.callback(&hostKeyStatus)
+	}
+	sshConfig := &ssh.ClientConfig{
+		User:            userName,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeysCallback(c.getSigners(keyFiles))},
+		HostKeyCallback: hostKeyCallback,
+	}
+	var conn net.Conn
+	var err error
+	if via == nil {
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, "tcp", hostPort)
+	} else {
+		conn, err = via.DialContext(ctx, "tcp", hostPort)
+	}
+	if err != nil {
+		return nil, hostKeyStatus, wrapTimeout(ctx, err)
+	}
+	if c.hostKeys != nil {
+		sshConfig.HostKeyAlgorithms = c.hostKeys.algorithms(hostPort, conn.RemoteAddr())
+	}
+	// The SSH handshake has no timeout of its own.  Closing the underlying
+	// connection when ctx expires prevents a host that accepts connections
+	// (but never completes the handshake) from hanging indefinitely.
+	handshakeDone := make(chan struct{})
+	closed := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+			closed <- true
+		case <-handshakeDone:
+			closed <- false
+		}
+	}()
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, hostPort, sshConfig)
+	close(handshakeDone)
+	if <-closed {
+		return nil, hostKeyStatus, fmt.Errorf("%w: %s: handshake did not complete", ErrTimeout, hostPort)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, hostKeyStatus, wrapTimeout(ctx, err)
+	}
+	return ssh.NewClient(sshConn, chans, reqs), hostKeyStatus, nil
+}
+
+// SyncBuffer is a bytes.Buffer that can be copied whilst another goroutine
+// is writing to it.
+type SyncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (s *SyncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Write(p)
+}
+
+// Snapshot returns a copy of everything written so far.
+func (s *SyncBuffer) Snapshot() bytes.Buffer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *bytes.NewBuffer(append([]byte(nil), s.b.Bytes()...))
+}
+
+// Output is the result of running a command on a remote host.
+type Output struct {
+	Stdout bytes.Buffer
+	Stderr bytes.Buffer
+	// ExitCode is the command's exit status, or -1 if it didn't exit
+	// normally.
+	ExitCode int
+}
+
+// Cmd runs a single command against a previously authenticated session and
+// returns its output and exit status.  A non-zero exit status is also
+// returned as an error.  If ctx expires before the command completes, the
+// session is closed and an ErrTimeout is returned, along with the output
+// read up to that point.
+func (c *Config) Cmd(ctx context.Context, client *ssh.Client, cmd string) (out Output, err error) {
+	out.ExitCode = -1
+	// Each ClientConn can support multiple interactive sessions,
+	// represented by a Session.
+	session, err := client.NewSession()
+	if err != nil {
+		err = fmt.Errorf("failed to create session: %w", wrapTimeout(ctx, err))
+		return
+	}
+	defer session.Close()
+	// Output is written to private buffers.  If the command times out, the
+	// session goroutine may still be writing to them when Cmd returns, so
+	// what has been read so far is copied.
+	var stdout, stderr SyncBuffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Run(cmd)
+	}()
+	select {
+	case err = <-done:
+		out.Stdout = stdout.Snapshot()
+		out.Stderr = stderr.Snapshot()
+		var exitErr *ssh.ExitError
+		switch {
+		case err == nil:
+			out.ExitCode = 0
+		case errors.As(err, &exitErr):
+			out.ExitCode = exitErr.ExitStatus()
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to run: %w", err)
+		}
+	case <-ctx.Done():
+		session.Signal(ssh.SIGKILL)
+		session.Close()
+		out.Stdout = stdout.Snapshot()
+		out.Stderr = stderr.Snapshot()
+		err = fmt.Errorf("%w: %s: %v", ErrTimeout, cmd, ctx.Err())
+	}
+	return
+}
+
+// wrapTimeout converts network timeouts and expired contexts into an
+// ErrTimeout.  Other errors are returned unmodified.
+func wrapTimeout(ctx context.Context, err error) error {
+	var netErr net.Error
+	if ctx.Err() != nil || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return fmt.Errorf("%w: %v", ErrTimeout, err)
+	}
+	return err
+}
@@ -0,0 +1,69 @@
+package sshclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestInvalidKey(t *testing.T) {
+	cfg := NewConfig()
+	err := cfg.AddKey("/invalid/filename")
+	if err == nil {
+		t.Fatal("Invalid filename failed to return an error")
+	}
+}
+
+func TestAuthTimeout(t *testing.T) {
+	// A listener that accepts connections but never performs an SSH
+	// handshake.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	cfg := NewConfig()
+	cfg.SetTimeout(200 * time.Millisecond)
+	h := Host{
+		HostName: "127.0.0.1",
+		Port:     l.Addr().(*net.TCPAddr).Port,
+		User:     "dummy",
+	}
+	t0 := time.Now()
+	_, _, _, err = cfg.Auth(context.Background(), h)
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("Expected a timeout error, Got=%v", err)
+	}
+	if time.Since(t0) > 2*time.Second {
+		t.Errorf("Auth took too long to time out: %v", time.Since(t0))
+	}
+}
+
+func TestCmdTimeout(t *testing.T) {
+	c := NewConfig()
+	client, _, err := c.connect(context.Background(), nil, "dummy", testServer(t, true), nil)
+	if err != nil {
+		t.Fatalf("Unable to connect: %v", err)
+	}
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	out, err := c.Cmd(ctx, client, "slow")
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("Expected a timeout error, Got=%v", err)
+	}
+	if out.Stdout.String() != "partial\n" {
+		t.Errorf("Output before the timeout was discarded: %q", out.Stdout.String())
+	}
+}
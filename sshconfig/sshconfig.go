@@ -0,0 +1,284 @@
+package sshconfig
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Config contains the blocks of an OpenSSH client configuration file.
+type Config struct {
+	blocks []block
+}
+
+// block is a Host or Match section and the options defined within it.
+// Options appearing before the first Host or Match apply to all hosts.
+type block struct {
+	keyword  string   // host, match or an empty string for global options
+	criteria []string // Host patterns or Match criteria
+	options  []option
+}
+
+type option struct {
+	keyword string
+	args    []string
+}
+
+// Host contains the settings that apply to a given host alias.
+type Host struct {
+	HostName      string
+	Port          int
+	User          string
+	IdentityFiles []string
+	ProxyJump     string
+}
+
+// ParseFile reads and parses an OpenSSH client configuration file.
+func ParseFile(filename string) (*Config, error) {
+	c := new(Config)
+	if err := c.parseFile(filename, 0); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Parse parses an OpenSSH client configuration from r.  Include directives
+// are resolved relative to ~/.ssh.
+func Parse(r io.Reader) (*Config, error) {
+	c := new(Config)
+	if err := c.parse(r, "-", 0); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Config) parseFile(filename string, depth int) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return c.parse(f, filename, depth)
+}
+
+// parse appends the blocks read from r to the Config.  Nested Include
+// directives are followed to a maximum depth, as in OpenSSH.
+func (c *Config) parse(r io.Reader, filename string, depth int) error {
+	if depth > 16 {
+		return fmt.Errorf("%s: too many nested includes", filename)
+	}
+	if len(c.blocks) == 0 {
+		c.blocks = append(c.blocks, block{})
+	}
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		keyword, args := splitLine(scanner.Text())
+		if keyword == "" {
+			continue
+		}
+		switch keyword {
+		case "host", "match":
+			if len(args) == 0 {
+				return fmt.Errorf("%s:%d: %s requires an argument", filename, lineNum, keyword)
+			}
+			c.blocks = append(c.blocks, block{keyword: keyword, criteria: args})
+		case "include":
+			for _, pattern := range args {
+				pattern = expandTilde(pattern)
+				if !path.IsAbs(pattern) {
+					pattern = expandTilde(path.Join("~/.ssh", pattern))
+				}
+				matches, err := filepath.Glob(pattern)
+				if err != nil {
+					return fmt.Errorf("%s:%d: %w", filename, lineNum, err)
+				}
+				for _, m := range matches {
+					if err := c.parseFile(m, depth+1); err != nil {
+						return err
+					}
+				}
+			}
+		default:
+			last := &c.blocks[len(c.blocks)-1]
+			last.options = append(last.options, option{keyword: keyword, args: args})
+		}
+	}
+	return scanner.Err()
+}
+
+// splitLine returns the lowercase keyword and arguments of a configuration
+// line.  Blank lines and comments return an empty keyword.
+func splitLine(line string) (string, []string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", nil
+	}
+	// Keywords may be separated from their arguments by whitespace or a
+	// single equals sign.
+	n := strings.IndexAny(line, " \t=")
+	if n < 0 {
+		return strings.ToLower(line), nil
+	}
+	keyword := strings.ToLower(line[:n])
+	rest := strings.TrimSpace(line[n:])
+	rest = strings.TrimSpace(strings.TrimPrefix(rest, "="))
+	return keyword, splitArgs(rest)
+}
+
+// splitArgs splits a string into whitespace separated arguments, honouring
+// double quotes.
+func splitArgs(s string) []string {
+	var args []string
+	var cur strings.Builder
+	inQuote := false
+	inArg := false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+			inArg = true
+		case (r == ' ' || r == '\t') && !inQuote:
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(r)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args
+}
+
+// Lookup returns the settings that apply to alias.  As with OpenSSH, the first
+// value obtained for each option is used, except IdentityFile which
+// accumulates.
+func (c *Config) Lookup(alias string) Host {
+	var h Host
+	seen := make(map[string]bool)
+	for _, b := range c.blocks {
+		if !b.matches(alias, h.HostName) {
+			continue
+		}
+		for _, o := range b.options {
+			if len(o.args) == 0 {
+				continue
+			}
+			if o.keyword == "identityfile" {
+				h.IdentityFiles = append(h.IdentityFiles, expandTilde(expandTokens(o.args[0], alias, h)))
+				continue
+			}
+			if seen[o.keyword] {
+				continue
+			}
+			seen[o.keyword] = true
+			switch o.keyword {
+			case "hostname":
+				h.HostName = expandTokens(o.args[0], alias, h)
+			case "port":
+				h.Port, _ = strconv.Atoi(o.args[0])
+			case "user":
+				h.User = o.args[0]
+			case "proxyjump":
+				h.ProxyJump = o.args[0]
+			}
+		}
+	}
+	return h
+}
+
+// matches returns true if the block applies to alias.  hostName is the value
+// of any HostName option obtained so far, which is what "Match host" tests.
+func (b *block) matches(alias, hostName string) bool {
+	switch b.keyword {
+	case "":
+		return true
+	case "host":
+		return matchPatternList(alias, b.criteria)
+	case "match":
+		if hostName == "" {
+			hostName = alias
+		}
+		for n := 0; n < len(b.criteria); n++ {
+			criterion := strings.ToLower(b.criteria[n])
+			negate := strings.HasPrefix(criterion, "!")
+			criterion = strings.TrimPrefix(criterion, "!")
+			var ok bool
+			switch criterion {
+			case "all":
+				ok = true
+			case "host", "originalhost":
+				if n+1 >= len(b.criteria) {
+					return false
+				}
+				n++
+				target := hostName
+				if criterion == "originalhost" {
+					target = alias
+				}
+				ok = matchPatternList(target, strings.Split(b.criteria[n], ","))
+			default:
+				// Unsupported criteria (exec, user, localuser, etc.) are
+				// treated as not matching.
+				return false
+			}
+			if ok == negate {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// matchPatternList returns true if s matches any of the patterns and none of
+// the negated (!) patterns.
+func matchPatternList(s string, patterns []string) bool {
+	matched := false
+	for _, p := range patterns {
+		if strings.HasPrefix(p, "!") {
+			if ok, _ := path.Match(strings.ToLower(p[1:]), strings.ToLower(s)); ok {
+				return false
+			}
+			continue
+		}
+		if ok, _ := path.Match(strings.ToLower(p), strings.ToLower(s)); ok {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// expandTokens replaces the subset of OpenSSH percent tokens that can be
+// resolved without connecting.
+func expandTokens(s, alias string, h Host) string {
+	hostName := h.HostName
+	if hostName == "" {
+		hostName = alias
+	}
+	r := strings.NewReplacer("%%", "%", "%h", hostName, "%n", alias, "%r", h.User)
+	return r.Replace(s)
+}
+
+// expandTilde expands paths that begin with ~/ to the user's home directory.
+func expandTilde(p string) string {
+	if !strings.HasPrefix(p, "~/") {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+	return path.Join(home, p[2:])
+}
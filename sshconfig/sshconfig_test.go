@@ -0,0 +1,77 @@
+package sshconfig
+
+import (
+	"strings"
+	"testing"
+)
+
+const testConfig = `
+# Global settings are overridden by earlier host blocks
+Host legacy01
+    HostName legacy01.corp.example.com
+    Port 2222
+    User svc_audit
+
+Host *.dmz.example.com !nodmz.dmz.example.com
+    ProxyJump bastion-dmz
+    IdentityFile ~/.ssh/dmz
+
+Host bastion-dmz
+    HostName=10.0.0.1
+    User jump
+
+Match host *.corp.example.com
+    IdentityFile "/etc/keys/corp key"
+
+Match originalhost web* !host web99
+    Port 8022
+
+Host *
+    User audit
+    Port 22
+    IdentityFile /etc/keys/default
+`
+
+func TestLookup(t *testing.T) {
+	c, err := Parse(strings.NewReader(testConfig))
+	if err != nil {
+		t.Fatalf("Unable to parse config: %v", err)
+	}
+	var tests = []struct {
+		alias      string
+		hostName   string
+		port       int
+		user       string
+		proxyJump  string
+		identities int
+	}{
+		{"legacy01", "legacy01.corp.example.com", 2222, "svc_audit", "", 2},
+		{"www.dmz.example.com", "", 22, "audit", "bastion-dmz", 2},
+		{"nodmz.dmz.example.com", "", 22, "audit", "", 1},
+		{"bastion-dmz", "10.0.0.1", 22, "jump", "", 1},
+		{"web01", "", 8022, "audit", "", 1},
+		{"web99", "", 22, "audit", "", 1},
+	}
+	for _, tt := range tests {
+		h := c.Lookup(tt.alias)
+		if h.HostName != tt.hostName {
+			t.Errorf("%s: Unexpected HostName: Wanted=%s, Got=%s", tt.alias, tt.hostName, h.HostName)
+		}
+		if h.Port != tt.port {
+			t.Errorf("%s: Unexpected Port: Wanted=%d, Got=%d", tt.alias, tt.port, h.Port)
+		}
+		if h.User != tt.user {
+			t.Errorf("%s: Unexpected User: Wanted=%s, Got=%s", tt.alias, tt.user, h.User)
+		}
+		if h.ProxyJump != tt.proxyJump {
+			t.Errorf("%s: Unexpected ProxyJump: Wanted=%s, Got=%s", tt.alias, tt.proxyJump, h.ProxyJump)
+		}
+		if len(h.IdentityFiles) != tt.identities {
+			t.Errorf("%s: Unexpected IdentityFiles: Wanted=%d, Got=%v", tt.alias, tt.identities, h.IdentityFiles)
+		}
+	}
+	h := c.Lookup("legacy01")
+	if h.IdentityFiles[0] != "/etc/keys/corp key" {
+		t.Errorf("Quoted IdentityFile not parsed: Got=%s", h.IdentityFiles[0])
+	}
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Sudo privilege levels.  They're ordered such that a higher value implies
+// greater privilege.
+const (
+	sudoNone = iota
+	sudoLimited
+	sudoAll
+	sudoAllNoPasswd
+)
+
+var sudoLevelNames = map[int]string{
+	sudoNone:        "",
+	sudoLimited:     "limited",
+	sudoAll:         "all",
+	sudoAllNoPasswd: "all-nopasswd",
+}
+
+// sudoGrant is the privilege a user receives from a single sudoers rule.
+type sudoGrant struct {
+	level    int
+	via      string // The principal that matched the user (e.g. %wheel)
+	runas    string
+	commands string
+}
+
+// sudoers contains the aliases defined in a sudoers file.
+type sudoers struct {
+	userAliases map[string][]string
+	hostAliases map[string][]string
+	cmndAliases map[string][]string
+}
+
+// sudoRule is a parsed user specification line.
+type sudoRule struct {
+	users    []string
+	hosts    []string
+	runas    string
+	tags     []string
+	commands []string
+}
+
+var (
+	// sudoTagRegex matches command tags such as NOPASSWD: and SETENV:
+	sudoTagRegex = regexp.MustCompile(`^([A-Z_]+):\s*`)
+	// sudoCommaRegex matches commas and any surrounding whitespace
+	sudoCommaRegex = regexp.MustCompile(`\s*,\s*`)
+	// sudoHostSpecRegex matches the colon that starts a further host_list =
+	// cmnd_spec_list in a user specification.
+	sudoHostSpecRegex = regexp.MustCompile(`^:\s*[^\s=:,()]+(\s*,\s*[^\s=:,()]+)*\s*=`)
+)
+
+// sudoLines joins continuation lines and strips comments from sudoers
+// content.  Include directives are dropped as the included files are expected
+// to be concatenated into the same input.
+func sudoLines(content string) []string {
+	var lines []string
+	var cur strings.Builder
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasSuffix(trimmed, "\\") {
+			cur.WriteString(strings.TrimSuffix(trimmed, "\\"))
+			cur.WriteString(" ")
+			continue
+		}
+		cur.WriteString(trimmed)
+		joined := cur.String()
+		cur.Reset()
+		if strings.HasPrefix(joined, "#include") || strings.HasPrefix(joined, "@include") {
+			continue
+		}
+		// A hash starts a comment unless it's followed by a digit, in which
+		// case it's a numeric UID or GID.
+		for n := 0; n < len(joined); n++ {
+			if joined[n] == '#' && (n+1 >= len(joined) || joined[n+1] < '0' || joined[n+1] > '9') {
+				joined = joined[:n]
+				break
+			}
+		}
+		joined = strings.TrimSpace(joined)
+		if joined != "" {
+			lines = append(lines, joined)
+		}
+	}
+	return lines
+}
+
+// splitList splits a comma separated sudoers list and trims each item.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseSudoers extracts the aliases and user specifications from sudoers
+// content.
+func parseSudoers(content string) (*sudoers, []sudoRule) {
+	s := &sudoers{
+		userAliases: make(map[string][]string),
+		hostAliases: make(map[string][]string),
+		cmndAliases: make(map[string][]string),
+	}
+	var rules []sudoRule
+	for _, line := range sudoLines(content) {
+		keyword := strings.Fields(line)[0]
+		switch keyword {
+		case "Defaults", "Runas_Alias":
+			continue
+		case "User_Alias", "Host_Alias", "Cmnd_Alias", "Cmd_Alias":
+			aliases := s.userAliases
+			if keyword == "Host_Alias" {
+				aliases = s.hostAliases
+			} else if keyword != "User_Alias" {
+				aliases = s.cmndAliases
+			}
+			// Multiple aliases can be defined on one line, separated by
+			// colons: NAME1 = a, b : NAME2 = c
+			for _, def := range strings.Split(strings.TrimSpace(line[len(keyword):]), ":") {
+				parts := strings.SplitN(def, "=", 2)
+				if len(parts) != 2 {
+					continue
+				}
+				aliases[strings.TrimSpace(parts[0])] = splitList(parts[1])
+			}
+			continue
+		}
+		if strings.HasPrefix(keyword, "Defaults") {
+			continue
+		}
+		rules = append(rules, parseSudoRules(line)...)
+	}
+	return s, rules
+}
+
+// parseSudoRules parses a user specification of the form:
+// user_list host_list = cmnd_spec_list [: host_list = cmnd_spec_list ...]
+// A rule is returned for each run of commands on a host list that share the
+// same runas specification and tags.
+func parseSudoRules(line string) []sudoRule {
+	parts := strings.SplitN(line, "=", 2)
+	if len(parts) != 2 {
+		return nil
+	}
+	// Remove whitespace after commas so the user and host lists can be
+	// split on whitespace.
+	left := sudoCommaRegex.ReplaceAllString(strings.TrimSpace(parts[0]), ",")
+	fields := strings.Fields(left)
+	if len(fields) != 2 {
+		return nil
+	}
+	users := splitList(fields[0])
+	hosts := splitList(fields[1])
+	var rules []sudoRule
+	rest := parts[1]
+	for {
+		spec, next := rest, ""
+		for n := 0; n < len(rest); n++ {
+			if rest[n] == ':' && sudoHostSpecRegex.MatchString(rest[n:]) {
+				spec, next = rest[:n], rest[n+1:]
+				break
+			}
+		}
+		rules = append(rules, parseCmndSpecs(users, hosts, spec)...)
+		if next == "" {
+			return rules
+		}
+		kv := strings.SplitN(next, "=", 2)
+		hosts = splitList(kv[0])
+		rest = kv[1]
+	}
+}
+
+// splitCmndList splits a cmnd_spec_list on the commas that aren't within a
+// runas specification, such as (root, operator), and trims each item.
+func splitCmndList(s string) []string {
+	var items []string
+	var item strings.Builder
+	depth := 0
+	flush := func() {
+		if trimmed := strings.TrimSpace(item.String()); trimmed != "" {
+			items = append(items, trimmed)
+		}
+		item.Reset()
+	}
+	for n := 0; n < len(s); n++ {
+		switch s[n] {
+		case '(':
+			depth++
+		case ')':
+			if depth > 0 {
+				depth--
+			}
+		case ',':
+			if depth == 0 {
+				flush()
+				continue
+			}
+		}
+		item.WriteByte(s[n])
+	}
+	flush()
+	return items
+}
+
+// setSudoTag adds a tag to a sorted list of tags, replacing its opposite
+// (e.g. PASSWD replaces NOPASSWD).
+func setSudoTag(tags []string, tag string) []string {
+	opposite := "NO" + tag
+	if strings.HasPrefix(tag, "NO") {
+		opposite = tag[2:]
+	}
+	var out []string
+	for _, t := range tags {
+		if t != tag && t != opposite {
+			out = append(out, t)
+		}
+	}
+	out = append(out, tag)
+	sort.Strings(out)
+	return out
+}
+
+// parseCmndSpecs parses a cmnd_spec_list.  A runas specification or tag
+// applies to the command it precedes and to every following command, until
+// it's overridden.
+func parseCmndSpecs(users, hosts []string, spec string) []sudoRule {
+	var rules []sudoRule
+	var runas string
+	var tags []string
+	for _, item := range splitCmndList(spec) {
+		if strings.HasPrefix(item, "(") {
+			if n := strings.Index(item, ")"); n > 0 {
+				runas = item[1:n]
+				item = strings.TrimSpace(item[n+1:])
+			}
+		}
+		for {
+			m := sudoTagRegex.FindStringSubmatch(item)
+			if m == nil {
+				break
+			}
+			tags = setSudoTag(tags, m[1])
+			item = item[len(m[0]):]
+		}
+		if item == "" {
+			continue
+		}
+		if n := len(rules) - 1; n >= 0 && rules[n].runas == runas && strings.Join(rules[n].tags, ",") == strings.Join(tags, ",") {
+			rules[n].commands = append(rules[n].commands, item)
+			continue
+		}
+		rules = append(rules, sudoRule{
+			users:    users,
+			hosts:    hosts,
+			runas:    runas,
+			tags:     tags,
+			commands: []string{item},
+		})
+	}
+	return rules
+}
+
+// expand recursively resolves aliases in a list.  Negated items are dropped.
+func expand(items []string, aliases map[string][]string, depth int) []string {
+	var out []string
+	for _, item := range items {
+		if strings.HasPrefix(item, "!") {
+			continue
+		}
+		if members, ok := aliases[item]; ok && depth < 10 {
+			out = append(out, expand(members, aliases, depth+1)...)
+			continue
+		}
+		out = append(out, item)
+	}
+	return out
+}
+
+// level returns the privilege a rule grants.
+func (s *sudoers) level(r sudoRule) int {
+	all := false
+	for _, c := range expand(r.commands, s.cmndAliases, 0) {
+		if c == "ALL" {
+			all = true
+		}
+	}
+	if !all {
+		return sudoLimited
+	}
+	if stringInSlice("NOPASSWD", r.tags) {
+		return sudoAllNoPasswd
+	}
+	return sudoAll
+}
+
+// appliesTo returns true if the rule's host list matches hostName.  Host
+// specifications that can't be evaluated remotely (netgroups, networks) are
+// assumed to match.
+func (s *sudoers) appliesTo(r sudoRule, hostName string) bool {
+	short := strings.SplitN(hostName, ".", 2)[0]
+	for _, host := range expand(r.hosts, s.hostAliases, 0) {
+		if host == "ALL" || host == hostName || host == short || strings.HasPrefix(host, short+".") {
+			return true
+		}
+		if strings.HasPrefix(host, "+") || net.ParseIP(host) != nil {
+			return true
+		}
+		if _, _, err := net.ParseCIDR(host); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSudoers resolves the rules in sudoers content into effective
+// privileges for each known user on a host.  It must be called after passwd
+// and group data has been parsed.
+func (h *hostsInfo) parseSudoers(hostName string, b bytes.Buffer) {
+	s, rules := parseSudoers(b.String())
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, r := range rules {
+		if !s.appliesTo(r, hostName) {
+			continue
+		}
+		grant := sudoGrant{
+			level:    s.level(r),
+			runas:    r.runas,
+			commands: strings.Join(r.commands, " "),
+		}
+		for _, principal := range expand(r.users, s.userAliases, 0) {
+			grant.via = principal
+			for _, userName := range h.sudoPrincipal(hostName, principal) {
+				u := h.users[hostName][userName]
+				u.sudo = append(u.sudo, grant)
+				h.users[hostName][userName] = u
+			}
+		}
+	}
+}
+
+// sudoPrincipal returns the known users on a host that match a sudoers user
+// specification (a username, #uid, %group, %#gid or ALL).
+func (h *hostsInfo) sudoPrincipal(hostName, principal string) []string {
+	var matched []string
+	for userName, u := range h.users[hostName] {
+		var ok bool
+		switch {
+		case principal == "ALL":
+			ok = true
+		case strings.HasPrefix(principal, "%#"):
+			gid, err := strconv.Atoi(principal[2:])
+			ok = err == nil && h.inGroup(hostName, userName, gid)
+		case strings.HasPrefix(principal, "%"):
+			g, exists := h.groups[hostName][principal[1:]]
+			ok = exists && h.inGroup(hostName, userName, g.gid)
+		case strings.HasPrefix(principal, "#"):
+			uid, err := strconv.Atoi(principal[1:])
+			ok = err == nil && u.uid == uid
+		default:
+			ok = userName == principal
+		}
+		if ok {
+			matched = append(matched, userName)
+		}
+	}
+	return matched
+}
+
+// inGroup returns true if a user is a member of the group with the given GID,
+// either as their primary group or a supplementary one.
+func (h *hostsInfo) inGroup(hostName, userName string, gid int) bool {
+	u := h.users[hostName][userName]
+	if u.gid == gid {
+		return true
+	}
+	for _, g := range u.groups {
+		if h.groups[hostName][g].gid == gid {
+			return true
+		}
+	}
+	return false
+}
+
+// sudoLevel returns the highest privilege level a user has been granted.
+func (u *userInfo) sudoLevel() string {
+	level := sudoNone
+	for _, g := range u.sudo {
+		if g.level > level {
+			level = g.level
+		}
+	}
+	return sudoLevelNames[level]
+}
+
+// writePrivilegedToFile exports every sudo grant for every user on every host.
+func (h *hostsInfo) writePrivilegedToFile(filename string) {
+	w, done := newCSVWriter(filename, "PrivilegedCSV")
+	defer done()
+	keys := make([]string, 0, len(h.users))
+	for k := range h.users {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, host := range keys {
+		for _, u := range h.allUsers {
+			info, exists := h.users[host][u]
+			if !exists {
+				continue
+			}
+			for _, g := range info.sudo {
+				w.Write([]string{host, u, sudoLevelNames[g.level], g.via, g.runas, g.commands})
+			}
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSudoers = `
+Defaults    env_reset
+Defaults:ADMINS !requiretty
+# Comments are ignored
+User_Alias  ADMINS = alice, \
+                     bob
+Cmnd_Alias  SHELLS = /bin/bash, /bin/sh : EVERYTHING = ALL
+Host_Alias  WEB = web01, web02
+
+root    ALL=(ALL)   ALL
+%wheel  ALL=(ALL)   ALL
+ADMINS  ALL=(ALL:ALL) NOPASSWD: EVERYTHING
+#1003   ALL=(root) /usr/bin/systemctl restart httpd
+dave    WEB = (root) SHELLS
+#includedir /etc/sudoers.d
+`
+
+func TestParseSudoers(t *testing.T) {
+	hosts := newHosts()
+	var passwd, group, sudo bytes.Buffer
+	passwd.WriteString("root:x:0:0:root:/root:/bin/bash\n")
+	passwd.WriteString("alice:x:1000:1000:Alice:/home/alice:/bin/bash\n")
+	passwd.WriteString("bob:x:1001:1001:Bob:/home/bob:/bin/bash\n")
+	passwd.WriteString("carol:x:1002:1002:Carol:/home/carol:/bin/bash\n")
+	passwd.WriteString("dave:x:1003:1003:Dave:/home/dave:/bin/bash\n")
+	passwd.WriteString("eve:x:1004:1004:Eve:/home/eve:/bin/bash\n")
+	group.WriteString("wheel:x:10:carol\n")
+	sudo.WriteString(testSudoers)
+	hosts.parsePasswd("db01", "files", passwd)
+	hosts.parseGroup("db01", group)
+	hosts.parseSudoers("db01", sudo)
+
+	var tests = []struct {
+		user  string
+		level string
+	}{
+		{"root", "all"},
+		{"alice", "all-nopasswd"},
+		{"bob", "all-nopasswd"},
+		{"carol", "all"},
+		// The SHELLS rule only applies to the WEB hosts
+		{"dave", "limited"},
+		{"eve", ""},
+	}
+	for _, tt := range tests {
+		u := hosts.users["db01"][tt.user]
+		if u.sudoLevel() != tt.level {
+			t.Errorf("%s: Unexpected sudo level: Wanted=%s, Got=%s", tt.user, tt.level, u.sudoLevel())
+		}
+	}
+	if len(hosts.users["db01"]["dave"].sudo) != 1 {
+		t.Errorf("dave: Unexpected grant count: Wanted=1, Got=%d", len(hosts.users["db01"]["dave"].sudo))
+	}
+	if via := hosts.users["db01"]["carol"].sudo[0].via; via != "%wheel" {
+		t.Errorf("carol: Unexpected grant principal: Wanted=%%wheel, Got=%s", via)
+	}
+}
+
+func TestParseSudoRules(t *testing.T) {
+	var tests = []struct {
+		line  string
+		rules []sudoRule
+	}{
+		{
+			"alice ALL=(root) /bin/ls, (ALL) NOPASSWD: ALL",
+			[]sudoRule{
+				{hosts: []string{"ALL"}, runas: "root", commands: []string{"/bin/ls"}},
+				{hosts: []string{"ALL"}, runas: "ALL", tags: []string{"NOPASSWD"}, commands: []string{"ALL"}},
+			},
+		},
+		{
+			"bob ALL=/bin/ls : otherhost=ALL",
+			[]sudoRule{
+				{hosts: []string{"ALL"}, commands: []string{"/bin/ls"}},
+				{hosts: []string{"otherhost"}, commands: []string{"ALL"}},
+			},
+		},
+		{
+			"carol web01, web02 = (root, operator) NOPASSWD: /bin/ls, /bin/cat, PASSWD: /bin/sh : db01 = (root:wheel) /bin/chown root:root /srv",
+			[]sudoRule{
+				{hosts: []string{"web01", "web02"}, runas: "root, operator", tags: []string{"NOPASSWD"}, commands: []string{"/bin/ls", "/bin/cat"}},
+				{hosts: []string{"web01", "web02"}, runas: "root, operator", tags: []string{"PASSWD"}, commands: []string{"/bin/sh"}},
+				{hosts: []string{"db01"}, runas: "root:wheel", commands: []string{"/bin/chown root:root /srv"}},
+			},
+		},
+		{"not a rule", nil},
+	}
+	for _, tt := range tests {
+		rules := parseSudoRules(tt.line)
+		if len(rules) != len(tt.rules) {
+			t.Errorf("%q: Unexpected rule count: Wanted=%d, Got=%d", tt.line, len(tt.rules), len(rules))
+			continue
+		}
+		for n, r := range rules {
+			want := tt.rules[n]
+			if strings.Join(r.hosts, ",") != strings.Join(want.hosts, ",") || r.runas != want.runas ||
+				strings.Join(r.tags, ",") != strings.Join(want.tags, ",") ||
+				strings.Join(r.commands, ",") != strings.Join(want.commands, ",") {
+				t.Errorf("%q: Unexpected rule %d: Wanted=%+v, Got=%+v", tt.line, n, want, r)
+			}
+		}
+	}
+}
+
+func TestParseSudoersSpecLists(t *testing.T) {
+	hosts := newHosts()
+	var passwd, sudo bytes.Buffer
+	passwd.WriteString("alice:x:1000:1000:Alice:/home/alice:/bin/bash\n")
+	passwd.WriteString("bob:x:1001:1001:Bob:/home/bob:/bin/bash\n")
+	sudo.WriteString("alice ALL=(root) /bin/ls, (ALL) NOPASSWD: ALL\n")
+	sudo.WriteString("bob ALL=/bin/ls : otherhost=ALL\n")
+	hosts.parsePasswd("db01", "files", passwd)
+	hosts.parseSudoers("db01", sudo)
+	alice := hosts.users["db01"]["alice"]
+	if l := alice.sudoLevel(); l != "all-nopasswd" {
+		t.Errorf("alice: Unexpected sudo level: Wanted=all-nopasswd, Got=%s", l)
+	}
+	bob := hosts.users["db01"]["bob"]
+	if len(bob.sudo) != 1 || bob.sudo[0].commands != "/bin/ls" || bob.sudoLevel() != "limited" {
+		t.Errorf("bob: Unexpected grants: %+v", bob.sudo)
+	}
+}
+
+func TestWritePrivilegedToFile(t *testing.T) {
+	hosts := newHosts()
+	var passwd, sudo bytes.Buffer
+	passwd.WriteString("alice:x:1000:1000:Alice:/home/alice:/bin/bash\n")
+	sudo.WriteString("alice ALL=(root, operator) /bin/ls, /bin/cat\n")
+	hosts.parsePasswd("db01", "files", passwd)
+	hosts.parseSudoers("db01", sudo)
+	fileName := filepath.Join(t.TempDir(), "privileged.csv")
+	hosts.writePrivilegedToFile(fileName)
+	f, err := os.Open(fileName)
+	if err != nil {
+		t.Fatalf("Unable to read output: %v", err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("Unable to parse output: %v", err)
+	}
+	expected := []string{"db01", "alice", "limited", "alice", "root, operator", "/bin/ls /bin/cat"}
+	if len(records) != 1 || strings.Join(records[0], "|") != strings.Join(expected, "|") {
+		t.Errorf("Unexpected records: Wanted=%q, Got=%q", expected, records)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// uidRange is the range of UIDs allocated to human accounts on a host.  UIDs
+// outside it belong to system accounts.
+type uidRange struct {
+	min int
+	max int
+}
+
+// defaultUIDRange is used for hosts whose range hasn't been set.  It matches
+// the shadow-utils defaults.
+var defaultUIDRange = uidRange{min: 1000, max: 60000}
+
+// Account classes
+const (
+	classHuman  = "human"
+	classSystem = "system"
+)
+
+// class returns whether a UID belongs to a human or system account.
+func (r uidRange) class(uid int) string {
+	if uid >= r.min && uid <= r.max {
+		return classHuman
+	}
+	return classSystem
+}
+
+// parseLoginDefs returns the UID range defined by UID_MIN and UID_MAX in the
+// content of /etc/login.defs.  Undefined or invalid values are taken from def.
+func parseLoginDefs(b bytes.Buffer, def uidRange) uidRange {
+	r := def
+	for _, line := range strings.Split(b.String(), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		n, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "UID_MIN":
+			r.min = n
+		case "UID_MAX":
+			r.max = n
+		}
+	}
+	if r.min > r.max {
+		return def
+	}
+	return r
+}
+
+// setUIDRange defines the human UID range for a host.  It must be called
+// before the host's passwd data is parsed.
+func (h *hostsInfo) setUIDRange(hostName string, r uidRange) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.uidRanges[hostName] = r
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/crooks/userlist/config"
+)
+
+func TestParseLoginDefs(t *testing.T) {
+	var tests = []struct {
+		content  string
+		expected uidRange
+	}{
+		{"# Min/max values for automatic uid selection in useradd\nUID_MIN\t\t\t  500\nUID_MAX\t\t\t60000\nSYS_UID_MIN\t\t  201\n", uidRange{500, 60000}},
+		{"UID_MIN 2000\n", uidRange{2000, 60000}},
+		{"UID_MIN bogus\n", defaultUIDRange},
+		{"UID_MIN 70000\n", defaultUIDRange},
+		{"", defaultUIDRange},
+	}
+	for _, tt := range tests {
+		r := parseLoginDefs(*bytes.NewBufferString(tt.content), defaultUIDRange)
+		if r != tt.expected {
+			t.Errorf("%q: Unexpected range: Wanted=%+v, Got=%+v", tt.content, tt.expected, r)
+		}
+	}
+}
+
+func TestPasswdFiltering(t *testing.T) {
+	hosts := newHosts()
+	hosts.shells = config.Shells{Exclude: []string{"false", "/usr/local/bin/restricted"}}
+	hosts.setUIDRange("host01", uidRange{500, 60000})
+	passwd := bytes.NewBufferString(`root:x:0:0:root:/root:/bin/bash
+svc_backup:x:498:498:Backup:/var/lib/backup:/usr/sbin/nologin
+alice:x:500:500:Alice:/home/alice:/bin/bash
+kiosk:x:501:501:Kiosk:/home/kiosk:/usr/local/bin/restricted
+nobody:x:65534:65534:nobody:/nonexistent:/bin/false
+`)
+	hosts.parsePasswd("host01", "files", *passwd)
+	var tests = []struct {
+		user  string
+		class string
+	}{
+		{"root", classSystem},
+		{"svc_backup", classSystem},
+		{"alice", classHuman},
+	}
+	for _, tt := range tests {
+		u, exists := hosts.users["host01"][tt.user]
+		if !exists {
+			t.Errorf("%s: User was not parsed", tt.user)
+			continue
+		}
+		if u.class != tt.class {
+			t.Errorf("%s: Unexpected class: Wanted=%s, Got=%s", tt.user, tt.class, u.class)
+		}
+	}
+	for _, user := range []string{"kiosk", "nobody"} {
+		if _, exists := hosts.users["host01"][user]; exists {
+			t.Errorf("%s: User with an excluded shell was parsed", user)
+		}
+	}
+}
@@ -3,19 +3,25 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"path"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Masterminds/log-go"
 	"github.com/crooks/jlog"
 	loglevel "github.com/crooks/log-go-level"
-	"github.com/crooks/sshcmds"
 	"github.com/crooks/userlist/config"
+	"github.com/crooks/userlist/sshclient"
 )
 
 var (
@@ -23,40 +29,120 @@ var (
 	flags *config.Flags
 )
 
+// hostsInfo is shared by all the workers in parseSources.  All access to its
+// fields must be made while holding mu.
 type hostsInfo struct {
+	mu        sync.Mutex
 	hostNames []string
 	users     map[string]map[string]userInfo
 	allUsers  []string
 	uidMap    map[int][]string
-	parsed    int // Number of hosts processed
-	success   int // Number of hosts successfully processed
+	groups    map[string]map[string]groupInfo
+	gidMap    map[int][]string
+	results   map[string]*hostResult
+	uidRanges map[string]uidRange // Human UID range of each host
+	shells    config.Shells       // Login shells to report
+	// namePriority determines which host's GECOS name is preferred
+	namePriority []string
+	parsed       int // Number of hosts processed
+	success      int // Number of hosts successfully processed
+}
+
+// target is a host to be processed, along with the source it was read from.
+// The user and port are only defined if the source entry specified them.
+type target struct {
+	hostName string
+	userName string
+	port     int
+	source   string
+}
+
+// parseTarget converts a source entry of the form [user@]host[:port] into a
+// target.
+func parseTarget(entry, source string) target {
+	t := target{source: source}
+	entry = strings.TrimSpace(entry)
+	if n := strings.LastIndex(entry, "@"); n >= 0 {
+		t.userName = entry[:n]
+		entry = entry[n+1:]
+	}
+	host, port, err := net.SplitHostPort(entry)
+	if err != nil {
+		// No port was specified
+		t.hostName = strings.Trim(entry, "[]")
+		return t
+	}
+	t.hostName = host
+	t.port, err = strconv.Atoi(port)
+	if err != nil {
+		log.Warnf("%s: Invalid port in source entry: %s", source, entry)
+	}
+	return t
+}
+
+// hostResult records the outcome of processing a single host.
+type hostResult struct {
+	status    string
+	hostKey   string
+	collected time.Time // When collection from the host started
+	duration  time.Duration
+	messages  []string
 }
 
 type userInfo struct {
+	source           string // Where the user was found (files or nss)
 	uid              int
+	class            string   // human or system, determined by UID
+	gid              int      // Primary GID
+	groups           []string // Supplementary groups
+	sudo             []sudoGrant
 	passwd           string
-	name             string
+	gecos            // Subfields of the passwd comment field
+	home             string
+	homeDir          homeDir
 	shell            string
+	authKeys         []authKey
+	jobs             []job // Scheduled jobs and services run as the user
+	sessions         int   // Current login sessions, -1 if unknown
+	processes        int   // Running processes, -1 if unknown
 	lastLoginDate    time.Time
+	lastLoginFrom    string
+	loginsKnown      bool // The host's login history was collected
+	failedLogins     int  // Failed login attempts recorded in btmp, -1 if unknown
 	passwdChangeDate time.Time
 	hash             string
+	hashStrength     string
+	locked           bool
+	aging            shadowAging
 }
 
 // newUser returns a partially populated userInfo struct
-func newUser(uid int, passwd, name, shell string) *userInfo {
+func newUser(source string, uid, gid int, passwd, name, shell string) *userInfo {
 	return &userInfo{
-		uid:    uid,
-		passwd: passwd,
-		name:   name,
-		shell:  shell,
+		// Aging remains unknown until a shadow entry is found
+		aging:        shadowAging{-1, -1, -1, -1, -1, -1, -1},
+		failedLogins: -1,
+		sessions:     -1,
+		processes:    -1,
+		source:       source,
+		uid:          uid,
+		gid:          gid,
+		passwd:       passwd,
+		gecos:        gecos{name: name},
+		shell:        shell,
 	}
 }
 
 // newHosts constructs a new instance of hostsInfo
 func newHosts() *hostsInfo {
 	return &hostsInfo{
-		users:  make(map[string]map[string]userInfo),
-		uidMap: make(map[int][]string),
+		users:     make(map[string]map[string]userInfo),
+		uidMap:    make(map[int][]string),
+		groups:    make(map[string]map[string]groupInfo),
+		gidMap:    make(map[int][]string),
+		results:   make(map[string]*hostResult),
+		uidRanges: make(map[string]uidRange),
+		shells:    config.Shells{Exclude: config.DefaultExcludeShells},
 	}
 }
 
@@ -101,14 +187,23 @@ func shortName(fqdn, defaultDomain string) string {
 	return fmt.Sprintf("%s.%s", hostname, domain)
 }
 
-// parsePasswd extracts the required fields from the /etc/passwd file and
-// populates a userInfo map for each line in it.  Note: This function
-// initialises a users struct for each user found.  Subsequent functions will
-// only populate fields in existing user structs.
-func (h *hostsInfo) parsePasswd(hostName string, b bytes.Buffer) {
-	unwantedShells := []string{"nologin", "false", "sync", "shutdown", "halt"}
+// parsePasswd extracts the required fields from the /etc/passwd file (or the
+// output of "getent passwd") and populates a userInfo map for each line in
+// it.  Each user is tagged with the given source.  Users that have already
+// been found on this host are not replaced so local files should be parsed
+// before NSS.  Note: This function initialises a users struct for each user
+// found.  Subsequent functions will only populate fields in existing user
+// structs.
+func (h *hostsInfo) parsePasswd(hostName, source string, b bytes.Buffer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r, ok := h.uidRanges[hostName]
+	if !ok {
+		r = defaultUIDRange
+	}
 	if h.users[hostName] == nil {
 		h.users[hostName] = map[string]userInfo{}
+		h.hostNames = append(h.hostNames, hostName)
 	}
 	// Iterate over each line in the passwd file
 	for _, line := range strings.Split(b.String(), "\n") {
@@ -119,11 +214,12 @@ func (h *hostsInfo) parsePasswd(hostName string, b bytes.Buffer) {
 		if len(fields) < 7 {
 			continue
 		}
+		if _, exists := h.users[hostName][userName]; exists {
+			continue
+		}
 		shell := fields[6]
 		// Skip users with an unwanted shell
-		shellWords := strings.Split(shell, "/")
-		shellName := shellWords[len(shellWords)-1]
-		if stringInSlice(shellName, unwantedShells) {
+		if !h.shells.Wanted(shell) {
 			log.Tracef(
 				"Skipping unwanted shell: host=%s, user=%s, shell=%s",
 				hostName,
@@ -140,24 +236,33 @@ func (h *hostsInfo) parsePasswd(hostName string, b bytes.Buffer) {
 			log.Warnf("%s: UID cannot be converted to integer", fields[2])
 			continue
 		}
+		gid, err := strconv.Atoi(fields[3])
+		if err != nil {
+			log.Warnf("%s: GID cannot be converted to integer", fields[3])
+			continue
+		}
 		// Populate the UID Map
 		if !stringInSlice(userName, h.uidMap[uid]) {
 			log.Debugf("%d: Adding %s to UID map", uid, userName)
 			h.uidMap[uid] = append(h.uidMap[uid], userName)
 		}
-		// Make a (hopefully not too bold) choice that the first (CSV)
-		// comment field is the user's real name.
-		name := strings.Split(fields[4], ",")[0]
-		h.users[hostName][userName] = *newUser(uid, passwd, name, shell)
+		g := parseGECOS(fields[4])
+		u := newUser(source, uid, gid, passwd, g.name, shell)
+		u.gecos = g
+		u.home = fields[5]
+		u.class = r.class(uid)
+		h.users[hostName][userName] = *u
 		if !stringInSlice(userName, h.allUsers) {
 			h.allUsers = append(h.allUsers, userName)
 		}
 	}
 }
 
-// parseShadow iterates each line of the /etc/shadow file and extracts the
-// fields required for each user.
+// parseShadow iterates each line of the /etc/shadow file (or the output of
+// "getent shadow") and extracts the fields required for each user.
 func (h *hostsInfo) parseShadow(hostName string, b bytes.Buffer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 	for _, line := range strings.Split(b.String(), "\n") {
 		fields := strings.Split(line, ":")
 		if len(fields) < 3 {
@@ -165,30 +270,14 @@ func (h *hostsInfo) parseShadow(hostName string, b bytes.Buffer) {
 		}
 		user := fields[0]
 
-		// Field 1 is the password hash.  A prefix of $6$ indicates the hash is
-		// type SHA512.  The following table is fairly self-explanitory.
-		var hash string
-		if strings.HasPrefix(fields[1], "$6$") {
-			hash = "sha512"
-		} else if strings.HasPrefix(fields[1], "$5$") {
-			hash = "sha256"
-		} else if strings.HasPrefix(fields[1], "$1$") {
-			hash = "md5"
-		} else if strings.HasPrefix(fields[1], "!") {
-			hash = "N/A"
-		} else if strings.HasPrefix(fields[1], "*") {
-			hash = "N/A"
-		} else if len(fields[1]) == 13 {
-			hash = "expired"
-		} else if len(fields[1]) == 0 {
-			hash = "blank"
-		} else {
-			hash = "unknown"
-		}
+		// Field 1 is the password hash.  Its prefix identifies the crypt
+		// algorithm and whether the account is locked.
+		hash, strength, locked := classifyHash(fields[1])
 
-		// Attempt to convert the third field to a Unix Epoch time
+		// Attempt to convert the third field to a Unix Epoch time.  An empty
+		// field is legitimate, it means password aging is disabled.
 		pwChgDate, err := stringToEpoch(fields[2])
-		if err != nil {
+		if err != nil && fields[2] != "" {
 			log.Warnf(
 				"Hostname=%s, User=%s, Filename=/etc/shadow: Unable to parse Epoch of: %s",
 				hostName,
@@ -205,60 +294,51 @@ func (h *hostsInfo) parseShadow(hostName string, b bytes.Buffer) {
 			u := h.users[hostName][user]
 			u.passwdChangeDate = pwChgDate
 			u.hash = hash
-			h.users[hostName][user] = u
-		}
-	}
-}
-
-// setLast converts a date string to a Time.  If the date is more recent than
-// the previous most recent for a given user, the lastLoginDate date for that user is
-// updated.
-func (u *userInfo) setLast(s string) {
-	lastdate, err := time.Parse("Jan 2 15:04:05 2006", s)
-	if err != nil {
-		panic(err)
-	}
-	if lastdate.After(u.lastLoginDate) {
-		u.lastLoginDate = lastdate
-	}
-}
-
-// parseLast iterates through the lines returned by the "lastLoginDate" command.  This
-// code is written for Red Hat which has a primitive output compared to other
-// Linux flavours.
-func (h *hostsInfo) parseLast(hostName string, b bytes.Buffer) {
-	for _, line := range strings.Split(b.String(), "\n") {
-		fields := strings.Fields(line)
-		if len(fields) < 2 {
-			continue
-		}
-		user := fields[0]
-		_, exists := h.users[hostName][user]
-		if exists {
-			u := h.users[hostName][user]
-			//u.setLast(fields[2])
-			u.setLast(strings.Join(fields[3:7], " "))
+			u.hashStrength = strength
+			u.locked = locked
+			u.aging = parseAging(fields)
 			h.users[hostName][user] = u
 		}
 	}
 }
 
 // nonBlankName iterates through all known hosts looking for a specified
-// userName.  If it finds one, it checks that the corresponding name field in
-// the users struct (The comments field in /etc/passwd) is not blank.  If this
-// is true, the name is returned as a string.
+// userName.  Of the hosts where the user's GECOS name is not blank, the name
+// is chosen according to h.namePriority.  Without a priority, the name on the
+// first host is returned.
 func (h *hostsInfo) nonBlankName(userName string) string {
+	var candidates []nameCandidate
 	for _, host := range h.hostNames {
 		// Test if this host has an entry for the specified userName
-		if _, ok := h.users[host][userName]; ok {
-			if len(h.users[host][userName].name) > 0 {
-				// The userName is good and the name field has some content.
-				return h.users[host][userName].name
-			}
+		if u, ok := h.users[host][userName]; ok && len(u.name) > 0 {
+			candidates = append(candidates, nameCandidate{host: host, source: u.source, name: u.name})
+		}
+	}
+	// If no hits were found, an empty string is returned.
+	return preferName(candidates, h.namePriority)
+}
+
+// sortAll puts the hostnames, usernames and UID map entries into a predictable
+// order.  Hosts are processed concurrently so the order in which they were
+// discovered varies from run to run.  This must be called after all the hosts
+// have been parsed and before any output is written.
+func (h *hostsInfo) sortAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	sort.Strings(h.hostNames)
+	sort.Strings(h.allUsers)
+	for uid := range h.uidMap {
+		sort.Strings(h.uidMap[uid])
+	}
+	for gid := range h.gidMap {
+		sort.Strings(h.gidMap[gid])
+	}
+	for _, users := range h.users {
+		for userName, u := range users {
+			sort.Strings(u.groups)
+			users[userName] = u
 		}
 	}
-	// Give up.  Unlikely as it seems, no hits were found.
-	return ""
 }
 
 // writeMapToFile produces two files.  One of conflicting UIDs and one of
@@ -302,6 +382,21 @@ func (h *hostsInfo) writeMapToFile(collisionsCSV, mapCSV string) {
 	bufm.Flush()
 }
 
+// dateThreshold is a hardcoded limit on how old a date can be before it's considered invalid.
+// This is principlally to stop 0 being treated as an Epoch date.
+var dateThreshold = time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// reported returns true if a user should be included in the output.
+func reported(info *userInfo) bool {
+	// Ignore entries without passwords set.  In AIX land, this is determined by an asterisk in the passwd
+	// field.  In Linux, it's the lack of a usable hash on the corresponding /etc/shadow entry.
+	if flags.PWOnly && !info.hasPassword() {
+		return false
+	}
+	// Optionally report only human or system accounts
+	return cfg.UIDRange.Report == "all" || info.class == cfg.UIDRange.Report
+}
+
 // writeToFile exports the map of hosts/users to a CSV file.
 func (h *hostsInfo) writeToFile(filename string) {
 	f, err := os.Create(filename)
@@ -321,17 +416,15 @@ func (h *hostsInfo) writeToFile(filename string) {
 
 	var lastLoginDate string
 	var passwdChangeDate string
-	// dateThreshold is a hardcoded limit on how old a date can be before it's considered invalid.
-	// This is principlally to stop 0 being treated as an Epoch date.
-	dateThreshold := time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)
+	var failedLogins string
+	// now is the reference time for deriving account states
+	now := time.Now()
 	// Iterate over the sorted hostnames
 	for _, host := range keys {
 		for _, u := range h.allUsers {
 			info, exists := h.users[host][u]
 			if exists {
-				// Ignore entries without passwords set.  In AIX land, this is determined by an asterisk in the passwd
-				// field.  In Linux, it's the lack of a hash on the corresponding /etc/shadow entry.
-				if flags.PWOnly && (info.passwd == "*" || info.hash == "N/A") {
+				if !reported(&info) {
 					continue
 				}
 				if info.passwdChangeDate.After(dateThreshold) {
@@ -344,10 +437,20 @@ func (h *hostsInfo) writeToFile(filename string) {
 				} else {
 					lastLoginDate = ""
 				}
+				if info.failedLogins >= 0 {
+					failedLogins = strconv.Itoa(info.failedLogins)
+				} else {
+					failedLogins = ""
+				}
 				line := fmt.Sprintf(
-					"%s,%s,%d,%s,%s,%s,%s,%s,%s\n",
+					"%s,%s,%d,%s,%s,%s,%s,%s,%s,%s,%d,%s,%s,%d,%s,%s,%s,%s,%s,%s,%s,%s,%d,%s\n",
 					host, u, info.uid, info.passwd, info.name, info.shell,
-					lastLoginDate, info.hash, passwdChangeDate,
+					lastLoginDate, info.hash, passwdChangeDate, info.source,
+					info.gid, strings.Join(info.groups, " "), info.sudoLevel(),
+					len(info.authKeys), info.aging.columns(now, info.locked),
+					info.hashStrength, info.lastLoginFrom, failedLogins, info.class,
+					info.gecos.columns(), info.home, info.homeDir.columns(info.uid),
+					len(info.jobs), info.activityColumns(now, cfg.StaleDays),
 				)
 				w.WriteString(line)
 			}
@@ -356,13 +459,77 @@ func (h *hostsInfo) writeToFile(filename string) {
 	w.Flush()
 }
 
+// newCSVWriter creates filename, for the output configured by setting, and
+// returns a CSV writer for it along with a function that flushes and closes
+// it.  Messages, commands, runas lists and key options frequently contain
+// commas, so fields are quoted where required.
+func newCSVWriter(filename, setting string) (*csv.Writer, func()) {
+	f, err := os.Create(filename)
+	if err != nil {
+		log.Fatalf("Unable to write %s: %s", setting, err)
+	}
+	w := csv.NewWriter(f)
+	return w, func() {
+		w.Flush()
+		if err := w.Error(); err != nil {
+			log.Fatalf("Unable to write %s: %s", setting, err)
+		}
+		f.Close()
+	}
+}
+
+// writeResultsToFile exports the outcome of processing each host to a CSV
+// file.
+func (h *hostsInfo) writeResultsToFile(filename string) {
+	w, done := newCSVWriter(filename, "ResultsCSV")
+	defer done()
+	keys := make([]string, 0, len(h.results))
+	for k := range h.results {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, host := range keys {
+		r := h.results[host]
+		w.Write([]string{
+			host, r.status, r.hostKey, fmt.Sprintf("%.2f", r.duration.Seconds()), strings.Join(r.messages, "; "),
+		})
+	}
+}
+
+// readPassphrase returns the passphrase for encrypted private keys.  The
+// environment variable named in cfg.PassphraseEnv takes precedence over the
+// content of cfg.PassphraseFile.
+func readPassphrase() []byte {
+	if cfg.PassphraseEnv != "" {
+		if p, ok := os.LookupEnv(cfg.PassphraseEnv); ok {
+			return []byte(p)
+		}
+		log.Warnf("Passphrase environment variable %s is not set", cfg.PassphraseEnv)
+	}
+	if cfg.PassphraseFile != "" {
+		p, err := os.ReadFile(cfg.PassphraseFile)
+		if err != nil {
+			log.Warnf("Unable to read passphrase file: %v", err)
+			return nil
+		}
+		return bytes.TrimRight(p, "\r\n")
+	}
+	return nil
+}
+
 // readPrivateKeys takes a slice of filenames relating to SSH private key files.
-// It returns an instance of sshcmds populated with valid private keys.
-func readPrivateKeys(keyFileNames []string) *sshcmds.Config {
-	sshSession := sshcmds.NewConfig()
+// It returns an instance of sshclient populated with valid private keys and,
+// optionally, a connection to ssh-agent.
+func readPrivateKeys(keyFileNames []string) *sshclient.Config {
+	sshSession := sshclient.NewConfig()
+	err := sshSession.SetKnownHosts(cfg.KnownHosts.Mode, cfg.KnownHosts.Files, cfg.KnownHosts.TOFUFile)
+	if err != nil {
+		log.Fatalf("Unable to read known_hosts: %v", err)
+	}
+	sshSession.SetPassphrase(readPassphrase())
 	validKeys := 0
 	for _, k := range keyFileNames {
-		err := sshSession.AddKey(cfg.SSHUser, k)
+		err := sshSession.AddKey(k)
 		if err != nil {
 			log.Warnf("%s: %s", k, err)
 			continue
@@ -370,6 +537,20 @@ func readPrivateKeys(keyFileNames []string) *sshcmds.Config {
 		log.Infof("Imported private key from %s", k)
 		validKeys++
 	}
+	if cfg.SSHAgent {
+		socket := os.Getenv("SSH_AUTH_SOCK")
+		if socket == "" {
+			log.Warn("ssh_agent is enabled but SSH_AUTH_SOCK is not set")
+		} else {
+			agentKeys, err := sshSession.AddAgent(socket)
+			if err != nil {
+				log.Warnf("Unable to connect to ssh-agent: %v", err)
+			} else {
+				log.Infof("ssh-agent holds %d keys", agentKeys)
+				validKeys += agentKeys
+			}
+		}
+	}
 	if validKeys > 0 {
 		log.Infof("Successfully imported %d private keys", validKeys)
 	} else {
@@ -378,52 +559,174 @@ func readPrivateKeys(keyFileNames []string) *sshcmds.Config {
 	return sshSession
 }
 
-// parseHost runs a series of SSH commands against a given host.
-func (hosts *hostsInfo) parseHost(inventoryHostName string, sshcfg sshcmds.Config) {
+// setResult records the outcome of processing a host.
+func (hosts *hostsInfo) setResult(hostName, status, hostKey string, collected time.Time, duration time.Duration, messages []string) {
+	hosts.mu.Lock()
+	defer hosts.mu.Unlock()
+	hosts.results[hostName] = &hostResult{
+		status:    status,
+		hostKey:   hostKey,
+		collected: collected,
+		duration:  duration,
+		messages:  messages,
+	}
+}
+
+// errStatus returns a result status that describes err.
+func errStatus(err error) string {
+	if errors.Is(err, sshclient.ErrTimeout) {
+		return "timeout"
+	}
+	if errors.Is(err, sshclient.ErrHostKeyMismatch) || errors.Is(err, sshclient.ErrHostKeyUnknown) {
+		return "hostkey"
+	}
+	return "failed"
+}
+
+// nonInteractive adds the -n option to sudo and doas commands, so that they
+// fail rather than prompt for a password.  Other commands are returned
+// unmodified.
+func nonInteractive(sudo string) string {
+	fields := strings.Fields(sudo)
+	if len(fields) == 0 || stringInSlice("-n", fields) {
+		return sudo
+	}
+	switch path.Base(fields[0]) {
+	case "sudo", "doas":
+		return strings.Join(append([]string{fields[0], "-n"}, fields[1:]...), " ")
+	}
+	return sudo
+}
+
+// parseHost runs a series of commands against a given host using runner.  The
+// entire process is constrained by the host timeout and each command is
+// additionally constrained by its own deadline.
+func (hosts *hostsInfo) parseHost(t target, runner Runner) {
+	inventoryHostName := t.hostName
+	hosts.mu.Lock()
 	hosts.parsed++
+	hosts.mu.Unlock()
 	hostName := shortName(inventoryHostName, cfg.DefaultDomain)
+	hostCfg := cfg.ForHost(inventoryHostName)
+	// User and port defined in the source entry take precedence over those
+	// in the config.
+	if t.userName != "" {
+		hostCfg.User = t.userName
+	}
+	if t.port != 0 {
+		hostCfg.Port = t.port
+	}
+	// When auditing the local host as root, privileged commands don't need
+	// sudo.  Otherwise, sudo mustn't prompt on the terminal of whoever is
+	// running userlist; missing privileges fail and are reported instead.
+	if t.source == "local" {
+		if os.Geteuid() == 0 {
+			hostCfg.SudoCommand = "none"
+		} else {
+			hostCfg.SudoCommand = nonInteractive(hostCfg.SudoCommand)
+		}
+	}
 	log.Infof("Processing host: %s", hostName)
 	hostT0 := time.Now()
-	client, err := sshcfg.Auth(hostName)
+	hostCtx, cancel := context.WithTimeout(context.Background(), hostCfg.HostTimeout)
+	defer cancel()
+	// messages collects non-fatal problems encountered on this host.  If any
+	// of them are timeouts, the host status is downgraded to partial.
+	var messages []string
+	status := "ok"
+	jump := cfg.JumpFor(inventoryHostName, t.source, hostCfg.ProxyJump)
+	if jump != "" {
+		log.Debugf("%s: Connecting via %s", inventoryHostName, jump)
+	}
+	// The address used to connect might differ from the name the host is
+	// reported as.
+	connectName := hostName
+	if hostCfg.HostName != "" {
+		connectName = hostCfg.HostName
+	}
+	conn, hostKey, hops, err := runner.Connect(hostCtx, sshclient.Host{
+		HostName: connectName,
+		Port:     hostCfg.Port,
+		User:     hostCfg.User,
+		Jump:     jump,
+		KeyFiles: hostCfg.PrivateKeys,
+		Timeout:  hostCfg.SSHTimeout,
+	})
+	// Jump host keys are reported against every host reached through them.
+	for _, hop := range hops {
+		switch hop.HostKey {
+		case sshclient.HostKeyMismatch:
+			log.Warnf("%s: Host key of jump host %s does not match known_hosts", inventoryHostName, hop.Hop)
+			messages = append(messages, "jump host "+hop.Hop+" host key mismatch")
+		case sshclient.HostKeyUnknown:
+			log.Warnf("%s: Host key of jump host %s is not in known_hosts", inventoryHostName, hop.Hop)
+		}
+	}
 	if err != nil {
 		log.Warnf("%s: SSH authentication returned: %s", inventoryHostName, err)
+		hosts.setResult(hostName, errStatus(err), hostKey, hostT0, time.Since(hostT0), append(messages, err.Error()))
 		return
 	}
-	defer client.Close()
-	var b bytes.Buffer
-	b, err = sshcfg.Cmd(client, "cat /etc/passwd")
-	if err != nil {
-		log.Warnf("%s: Unable to parse /etc/passwd: %v", inventoryHostName, err)
-		return
+	switch hostKey {
+	case sshclient.HostKeyMismatch:
+		log.Warnf("%s: Host key does not match known_hosts", inventoryHostName)
+		messages = append(messages, "host key mismatch")
+	case sshclient.HostKeyUnknown:
+		log.Warnf("%s: Host key is not in known_hosts", inventoryHostName)
+	case sshclient.HostKeyRecorded:
+		log.Infof("%s: Recorded new host key", inventoryHostName)
 	}
-	hosts.parsePasswd(hostName, b)
-
-	b, err = sshcfg.Cmd(client, "sudo cat /etc/shadow")
-	if err != nil {
-		log.Infof("%s: Cannot parse /etc/shadow: %v", inventoryHostName, err)
-	} else {
-		hosts.parseShadow(hostName, b)
+	defer conn.Close()
+	// run executes cmd on the host, constrained by the deadline for the named
+	// command.
+	run := func(name, cmd string) (bytes.Buffer, error) {
+		ctx, cancel := context.WithTimeout(hostCtx, hostCfg.CommandDeadline(name))
+		defer cancel()
+		out, err := conn.Run(ctx, cmd)
+		if errors.Is(err, sshclient.ErrTimeout) {
+			status = "partial"
+		}
+		if err != nil && out.Stderr.Len() > 0 {
+			log.Debugf("%s: %s exited %d: %s", inventoryHostName, name, out.ExitCode, strings.TrimSpace(out.Stderr.String()))
+		}
+		return out.Stdout, err
 	}
+	// The operating system determines how some of the data is collected.
+	osName := "Linux"
+	if b, err := run("uname", "uname -s"); err == nil {
+		osName = strings.TrimSpace(b.String())
+	}
+	log.Debugf("%s: Operating system is %s", inventoryHostName, osName)
 
-	b, err = sshcfg.Cmd(client, "last -aF")
-	if err != nil {
-		log.Infof("%s: Unable to run \"last\" command: %v", inventoryHostName, err)
-	} else {
-		hosts.parseLast(hostName, b)
+	// The human UID range is needed to classify users as passwd is parsed.
+	// The logindefs collector may replace it with the host's own range.
+	hosts.setUIDRange(hostName, uidRange{min: cfg.UIDRange.Min, max: cfg.UIDRange.Max})
+
+	s := &hostSession{hosts: hosts, hostName: hostName, osName: osName}
+	if err := s.collect(hostCtx, run, hostCfg.CollectorEnabled, hostCfg.Privileged); err != nil {
+		log.Warnf("%s: %v", inventoryHostName, err)
+		hosts.setResult(hostName, errStatus(err), hostKey, hostT0, time.Since(hostT0), append(append(messages, s.messages...), err.Error()))
+		return
+	}
+	messages = append(messages, s.messages...)
+	// The final collector may have been cut short by the host deadline.
+	if hostCtx.Err() != nil {
+		status = "timeout"
 	}
 
-	hostT1 := time.Now()
-	hostDuration := hostT1.Sub(hostT0)
+	hostDuration := time.Since(hostT0)
+	hosts.setResult(hostName, status, hostKey, hostT0, hostDuration, messages)
+	hosts.mu.Lock()
 	hosts.success++
+	hosts.mu.Unlock()
 	log.Debugf("%s: Parsed in %.2f seconds", hostName, hostDuration.Seconds())
 }
 
-// parseSources iterates through a series of hostnames collected from URLs, files and/or a simple list.
-func (hosts *hostsInfo) parseSources() {
-	// Create an sshSession and import Private keys into it.
-	sshSession := readPrivateKeys(cfg.PrivateKeys)
-
-	totalT0 := time.Now()
+// queueHosts iterates through a series of hostnames collected from URLs, files
+// and/or a simple list and feeds each of them into the queue channel.  The
+// channel is closed when all the sources have been read.
+func queueHosts(queue chan<- target) {
+	defer close(queue)
 	// Iterate over a list of URLs that contain hostnames
 	for _, s := range cfg.Sources.URLs {
 		url, err := http.Get(s)
@@ -431,30 +734,67 @@ func (hosts *hostsInfo) parseSources() {
 			log.Warnf("Error parsing URL %s: %v", s, err)
 			continue
 		}
-		defer url.Body.Close()
 		scanner := bufio.NewScanner(url.Body)
 		// Iterate over the lines within a given URL
 		for scanner.Scan() {
-			hosts.parseHost(scanner.Text(), *sshSession)
+			queue <- parseTarget(scanner.Text(), s)
 		}
+		url.Body.Close()
 	}
 	// Iterate over a list of files that contain hostnames
 	for _, s := range cfg.Sources.Files {
 		f, err := os.Open(s)
 		if err != nil {
 			log.Warnf("Error parsing file %s: %v", s, err)
+			continue
 		}
-		defer f.Close()
 		scanner := bufio.NewScanner(f)
 		// Iterate over the lines within a given file
 		for scanner.Scan() {
-			hosts.parseHost(scanner.Text(), *sshSession)
+			queue <- parseTarget(scanner.Text(), s)
 		}
+		f.Close()
 	}
 	// Iterate over a simple list of hostnames
 	for _, s := range cfg.Sources.Servers {
-		hosts.parseHost(s, *sshSession)
+		queue <- parseTarget(s, "servers")
+	}
+	// The local host is reported by its own name
+	if cfg.Sources.Local {
+		hostName, err := os.Hostname()
+		if err != nil {
+			log.Warnf("Unable to determine local hostname: %v", err)
+			hostName = "localhost"
+		}
+		queue <- target{hostName: hostName, source: "local"}
 	}
+}
+
+// parseSources processes all the hosts defined in the sources.  Remote hosts
+// are reached using remote and the local host is audited directly.  A pool of
+// cfg.Concurrency workers is used so that many hosts can be collected in
+// parallel and one slow host doesn't hold up those behind it.
+func (hosts *hostsInfo) parseSources(remote Runner) {
+	local := new(localRunner)
+	totalT0 := time.Now()
+	queue := make(chan target)
+	go queueHosts(queue)
+	var wg sync.WaitGroup
+	for n := 0; n < cfg.Concurrency; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range queue {
+				if t.source == "local" {
+					hosts.parseHost(t, local)
+				} else {
+					hosts.parseHost(t, remote)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	hosts.sortAll()
 	totalT1 := time.Now()
 	totalDuration := totalT1.Sub(totalT0)
 	log.Infof(
@@ -483,9 +823,28 @@ func main() {
 
 	// Create a new instance of hostsInfo
 	hosts := newHosts()
+	hosts.shells = cfg.Shells
+	hosts.namePriority = cfg.NamePriority
+	checkCollectorNames(cfg.CollectorNames())
+	// Create an sshSession and import Private keys into it.  Private keys
+	// aren't required if only the local host is being audited.
+	var remote Runner
+	if cfg.RemoteSources() {
+		remote = &sshRunner{cfg: readPrivateKeys(cfg.PrivateKeys)}
+		defer remote.Close()
+	}
 	// This is where all the work happens
-	hosts.parseSources()
+	hosts.parseSources(remote)
 	// Write the gathered user data to a file
 	hosts.writeToFile(cfg.OutFileCSV)
 	hosts.writeMapToFile(cfg.CollisionsCSV, cfg.UIDMapCSV)
+	hosts.writeGroupsToFile(cfg.GroupsCSV)
+	hosts.writeGIDCollisionsToFile(cfg.GIDCollisionsCSV)
+	hosts.writePrivilegedToFile(cfg.PrivilegedCSV)
+	hosts.writeKeysToFile(cfg.KeysCSV)
+	hosts.writeJobsToFile(cfg.JobsCSV)
+	hosts.writeResultsToFile(cfg.ResultsCSV)
+	if cfg.JSONFile != "" {
+		hosts.writeJSONToFile(cfg.JSONFile)
+	}
 }
@@ -1,7 +1,18 @@
 package main
 
 import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/crooks/userlist/config"
+	"github.com/crooks/userlist/sshclient"
 )
 
 func TestShortName(t *testing.T) {
@@ -24,3 +35,233 @@ func TestShortName(t *testing.T) {
 		}
 	}
 }
+
+func TestConcurrentParse(t *testing.T) {
+	hosts := newHosts()
+	var wg sync.WaitGroup
+	for n := 0; n < 20; n++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			var b bytes.Buffer
+			fmt.Fprintf(&b, "user%02d:x:%d:100:User %d:/home/user:/bin/bash\n", n, 1000+n, n)
+			b.WriteString("shared:x:2000:100:Shared:/home/shared:/bin/bash\n")
+			hosts.parsePasswd(fmt.Sprintf("host%02d", n), "files", b)
+		}(n)
+	}
+	wg.Wait()
+	hosts.sortAll()
+	if len(hosts.hostNames) != 20 {
+		t.Fatalf("Unexpected host count: Wanted=20, Got=%d", len(hosts.hostNames))
+	}
+	if hosts.hostNames[0] != "host00" || hosts.hostNames[19] != "host19" {
+		t.Errorf("Hostnames not sorted: %v", hosts.hostNames)
+	}
+	// 20 unique users plus the shared user
+	if len(hosts.allUsers) != 21 {
+		t.Fatalf("Unexpected user count: Wanted=21, Got=%d", len(hosts.allUsers))
+	}
+	if hosts.allUsers[0] != "shared" || hosts.allUsers[1] != "user00" {
+		t.Errorf("Usernames not sorted: %v", hosts.allUsers)
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	var tests = []struct {
+		entry    string
+		hostName string
+		userName string
+		port     int
+	}{
+		{"legacy01", "legacy01", "", 0},
+		{"svc_audit@legacy01", "legacy01", "svc_audit", 0},
+		{"svc_audit@legacy01:2222", "legacy01", "svc_audit", 2222},
+		{"legacy01.example.com:2222", "legacy01.example.com", "", 2222},
+		{"[2001:db8::1]:2222", "2001:db8::1", "", 2222},
+	}
+	for _, tt := range tests {
+		target := parseTarget(tt.entry, "servers")
+		if target.hostName != tt.hostName || target.userName != tt.userName || target.port != tt.port {
+			t.Errorf(
+				"Unexpected target for %s: Wanted=%s@%s:%d, Got=%s@%s:%d",
+				tt.entry, tt.userName, tt.hostName, tt.port, target.userName, target.hostName, target.port,
+			)
+		}
+	}
+}
+
+func TestParsePasswdSources(t *testing.T) {
+	hosts := newHosts()
+	var files, nss bytes.Buffer
+	files.WriteString("root:x:0:0:root:/root:/bin/bash\n")
+	files.WriteString("daemon:x:1:1:daemon:/usr/sbin:/usr/sbin/nologin\n")
+	files.WriteString("alice:x:1000:1000:Alice Local,,,:/home/alice:/bin/bash\n")
+	// getent returns local users as well as those from NSS
+	nss.WriteString("root:x:0:0:root:/root:/bin/bash\n")
+	nss.WriteString("alice:*:1000:1000:Alice LDAP:/home/alice:/bin/bash\n")
+	nss.WriteString("bob:*:50001:50001:Bob LDAP:/home/bob:/bin/bash\n")
+	hosts.parsePasswd("host01", "files", files)
+	hosts.parsePasswd("host01", "nss", nss)
+	var tests = []struct {
+		user   string
+		source string
+		name   string
+	}{
+		{"root", "files", "root"},
+		{"alice", "files", "Alice Local"},
+		{"bob", "nss", "Bob LDAP"},
+	}
+	for _, tt := range tests {
+		u, ok := hosts.users["host01"][tt.user]
+		if !ok {
+			t.Errorf("%s: User not found", tt.user)
+			continue
+		}
+		if u.source != tt.source || u.name != tt.name {
+			t.Errorf("%s: Wanted=%s/%s, Got=%s/%s", tt.user, tt.source, tt.name, u.source, u.name)
+		}
+	}
+	if _, ok := hosts.users["host01"]["daemon"]; ok {
+		t.Error("User with nologin shell should have been skipped")
+	}
+}
+
+func TestParseSourcesFixtures(t *testing.T) {
+	savedCfg, savedFlags := cfg, flags
+	defer func() { cfg, flags = savedCfg, savedFlags }()
+	var err error
+	cfg, err = config.ParseConfig("testdata/userlist.yml")
+	if err != nil {
+		t.Fatalf("Unable to parse config: %v", err)
+	}
+	flags = new(config.Flags)
+	cfg.JumpHosts = []config.JumpHost{{Pattern: "web01", Via: "bastion"}}
+	runner := newFixtureRunner("testdata/hosts")
+	runner.hopKeys = map[string]string{"bastion": sshclient.HostKeyMismatch}
+	hosts := newHosts()
+	hosts.shells = cfg.Shells
+	hosts.parseSources(runner)
+
+	var results = []struct {
+		host    string
+		status  string
+		message string
+	}{
+		{"web01", "ok", "jump host bastion host key mismatch"},
+		{"db01", "ok", "shadow: failed to run"},
+		{"gone01", "failed", "connection refused"},
+	}
+	for _, tt := range results {
+		r, ok := hosts.results[tt.host]
+		if !ok {
+			t.Errorf("%s: No result", tt.host)
+			continue
+		}
+		messages := strings.Join(r.messages, "; ")
+		if r.status != tt.status || !strings.Contains(messages, tt.message) {
+			t.Errorf("%s: Unexpected result: status=%s, messages=%s", tt.host, r.status, messages)
+		}
+	}
+	if hosts.success != 2 || hosts.parsed != 3 {
+		t.Errorf("Unexpected counts: success=%d, parsed=%d", hosts.success, hosts.parsed)
+	}
+	if !stringInSlice("sudo cat /etc/shadow", runner.commands("web01")) {
+		t.Errorf("shadow should be read with sudo: %q", runner.commands("web01"))
+	}
+
+	if _, ok := hosts.users["web01"]["daemon"]; ok {
+		t.Error("daemon has an excluded shell and should not be reported")
+	}
+	alice := hosts.users["web01"]["alice"]
+	if alice.hash != "sha512" || alice.gecos.name != "Alice Smith" || alice.lastLoginFrom != "10.0.0.5" {
+		t.Errorf("Unexpected alice: hash=%s, name=%s, from=%s", alice.hash, alice.gecos.name, alice.lastLoginFrom)
+	}
+	if !stringInSlice("wheel", alice.groups) {
+		t.Errorf("alice should be in wheel: %v", alice.groups)
+	}
+	bob := hosts.users["web01"]["bob"]
+	if bob.hashStrength != strengthWeak || bob.processes != 1 || !bob.staleActive(time.Now(), cfg.StaleDays) {
+		t.Errorf("Unexpected bob: strength=%s, processes=%d", bob.hashStrength, bob.processes)
+	}
+	carol := hosts.users["db01"]["carol"]
+	if carol.hash != "" || carol.processes != -1 {
+		t.Errorf("Unexpected carol: hash=%s, processes=%d", carol.hash, carol.processes)
+	}
+
+	outFile := filepath.Join(t.TempDir(), "userlist.csv")
+	hosts.writeToFile(outFile)
+	b, err := os.ReadFile(outFile)
+	if err != nil {
+		t.Fatalf("Unable to read output: %v", err)
+	}
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		fields := strings.SplitN(line, ",", 3)
+		got = append(got, fields[0]+":"+fields[1])
+	}
+	expected := "db01:carol,db01:root,web01:alice,web01:bob,web01:root"
+	if strings.Join(got, ",") != expected {
+		t.Errorf("Unexpected output rows: Wanted=%s, Got=%s", expected, strings.Join(got, ","))
+	}
+}
+
+func TestQueueHostsLocal(t *testing.T) {
+	savedCfg := cfg
+	defer func() { cfg = savedCfg }()
+	cfg = new(config.Config)
+	cfg.Sources.Servers = []string{"audit@web01:2222"}
+	cfg.Sources.Local = true
+	queue := make(chan target)
+	go queueHosts(queue)
+	var targets []target
+	for t := range queue {
+		targets = append(targets, t)
+	}
+	hostName, _ := os.Hostname()
+	if len(targets) != 2 {
+		t.Fatalf("Expected 2 targets, got %d", len(targets))
+	}
+	if targets[0].source != "servers" || targets[1].source != "local" || targets[1].hostName != hostName {
+		t.Errorf("Unexpected targets: %+v", targets)
+	}
+}
+
+func TestWriteResultsToFile(t *testing.T) {
+	hosts := newHosts()
+	msg := "ssh: unable to authenticate, attempted methods [none publickey], no supported methods remain"
+	hosts.setResult("web01", "failed", "known", time.Now(), 1500*time.Millisecond, []string{msg, "jobs: timeout"})
+	fileName := filepath.Join(t.TempDir(), "results.csv")
+	hosts.writeResultsToFile(fileName)
+	f, err := os.Open(fileName)
+	if err != nil {
+		t.Fatalf("Unable to read output: %v", err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("Unable to parse output: %v", err)
+	}
+	expected := []string{"web01", "failed", "known", "1.50", msg + "; jobs: timeout"}
+	if len(records) != 1 || strings.Join(records[0], "|") != strings.Join(expected, "|") {
+		t.Errorf("Unexpected records: Wanted=%q, Got=%q", expected, records)
+	}
+}
+
+func TestNonInteractive(t *testing.T) {
+	var tests = []struct {
+		sudo     string
+		expected string
+	}{
+		{"sudo", "sudo -n"},
+		{"/usr/bin/sudo -u audit", "/usr/bin/sudo -n -u audit"},
+		{"sudo -n", "sudo -n"},
+		{"doas", "doas -n"},
+		{"pfexec", "pfexec"},
+		{"none", "none"},
+	}
+	for _, tt := range tests {
+		if got := nonInteractive(tt.sudo); got != tt.expected {
+			t.Errorf("%s: Wanted=%s, Got=%s", tt.sudo, tt.expected, got)
+		}
+	}
+}
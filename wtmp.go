@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Sizes and offsets of the Linux (glibc) utmp and lastlog records.  These are
+// the same on 32 and 64 bit platforms as the timestamps are always 32 bits.
+const (
+	utmpSize       = 384
+	utmpOffLine    = 8
+	utmpOffUser    = 44
+	utmpOffHost    = 76
+	utmpOffTime    = 340
+	utmpLineSize   = 32
+	utmpUserSize   = 32
+	utmpHostSize   = 256
+	lastlogSize    = 292
+	lastlogOffHost = 36
+)
+
+// utmp record types (see utmp(5))
+const (
+	utmpMaxType     = 9
+	utmpUserProcess = 7
+)
+
+// utmpRecord is the subset of a utmp/wtmp/btmp record that userlist uses.
+type utmpRecord struct {
+	typ  int
+	line string
+	user string
+	host string
+	t    time.Time
+}
+
+// cString returns the content of a NUL padded byte array.
+func cString(b []byte) string {
+	if n := bytes.IndexByte(b, 0); n >= 0 {
+		b = b[:n]
+	}
+	return string(b)
+}
+
+// utmpByteOrder guesses the byte order of a set of utmp records from the type
+// field of the first record, which is always small.
+func utmpByteOrder(b []byte) binary.ByteOrder {
+	if len(b) >= 2 && binary.LittleEndian.Uint16(b) <= utmpMaxType {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+// parseUtmp decodes the concatenated utmp records in b.  Records with an
+// invalid type are skipped.  The number of bytes that couldn't be decoded
+// (either a truncated final record or invalid records) is returned.
+func parseUtmp(b []byte) (records []utmpRecord, bad int) {
+	order := utmpByteOrder(b)
+	for len(b) >= utmpSize {
+		rec := b[:utmpSize]
+		b = b[utmpSize:]
+		typ := int(order.Uint16(rec))
+		if typ > utmpMaxType {
+			bad += utmpSize
+			continue
+		}
+		records = append(records, utmpRecord{
+			typ:  typ,
+			line: cString(rec[utmpOffLine : utmpOffLine+utmpLineSize]),
+			user: cString(rec[utmpOffUser : utmpOffUser+utmpUserSize]),
+			host: cString(rec[utmpOffHost : utmpOffHost+utmpHostSize]),
+			t:    time.Unix(int64(int32(order.Uint32(rec[utmpOffTime:]))), 0),
+		})
+	}
+	bad += len(b)
+	return
+}
+
+// rawLogCmd returns a command that writes the content of all the log files
+// matching pattern to stdout, decompressing any that have been rotated and
+// compressed.
+func rawLogCmd(pattern string) string {
+	return fmt.Sprintf(
+		"sh -c 'for f in %s; do case \"$f\" in *.gz) gzip -dc \"$f\";; *.xz) xz -dc \"$f\";; *.bz2) bzip2 -dc \"$f\";; *) cat \"$f\";; esac; done 2>/dev/null'",
+		pattern,
+	)
+}
+
+// parseWtmp updates the last login of each user from the USER_PROCESS records
+// in wtmp.  It returns the number of bytes that couldn't be decoded.
+func (h *hostsInfo) parseWtmp(hostName string, b bytes.Buffer) int {
+	records, bad := parseUtmp(b.Bytes())
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, r := range records {
+		if r.typ != utmpUserProcess || r.user == "" {
+			continue
+		}
+		if u, exists := h.users[hostName][r.user]; exists {
+			u.setLast(r.t, r.host)
+			h.users[hostName][r.user] = u
+		}
+	}
+	return bad
+}
+
+// parseBtmp counts the failed login attempts recorded against each user in
+// btmp.  Attempts for unknown usernames are ignored.  It returns the number of
+// bytes that couldn't be decoded.
+func (h *hostsInfo) parseBtmp(hostName string, b bytes.Buffer) int {
+	records, bad := parseUtmp(b.Bytes())
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// A readable btmp means a count of zero is meaningful for every user.
+	for name, u := range h.users[hostName] {
+		u.failedLogins = 0
+		h.users[hostName][name] = u
+	}
+	for _, r := range records {
+		if u, exists := h.users[hostName][r.user]; exists {
+			u.failedLogins++
+			h.users[hostName][r.user] = u
+		}
+	}
+	return bad
+}
+
+// lastlogUIDs returns the sorted, unique UIDs of the users known on a host.
+func (h *hostsInfo) lastlogUIDs(hostName string) []int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	seen := make(map[int]bool)
+	var uids []int
+	for _, u := range h.users[hostName] {
+		if u.uid >= 0 && !seen[u.uid] {
+			seen[u.uid] = true
+			uids = append(uids, u.uid)
+		}
+	}
+	sort.Ints(uids)
+	return uids
+}
+
+// lastlogBatches splits uids, in order, into batches that fit within a single
+// lastlogCmd.
+func lastlogBatches(uids []int) [][]int {
+	words := make([]string, len(uids))
+	for n, uid := range uids {
+		words[n] = fmt.Sprint(uid)
+	}
+	var batches [][]int
+	for _, batch := range argBatches(words) {
+		batches = append(batches, uids[:len(batch)])
+		uids = uids[len(batch):]
+	}
+	return batches
+}
+
+// lastlogCmd returns a command that outputs the lastlog record for each of
+// uids, in order.  The UIDs are embedded, rather than read on the host, so
+// that each record can be matched to its UID; long lists are split with
+// lastlogBatches.  Lastlog is a sparse file indexed by UID so it can be
+// enormous if large UIDs (such as nfsnobody) are present; fetching individual
+// records avoids transferring it all.  Records beyond the end of the file are
+// padded with zeros so that every UID produces exactly one record.
+func lastlogCmd(uids []int) string {
+	list := make([]string, len(uids))
+	for n, uid := range uids {
+		list[n] = fmt.Sprint(uid)
+	}
+	return fmt.Sprintf(
+		"sh -c 'for u in %s; do { dd if=/var/log/lastlog bs=%d skip=$u count=1 2>/dev/null; head -c %d /dev/zero; } | head -c %d; done'",
+		strings.Join(list, " "), lastlogSize, lastlogSize, lastlogSize,
+	)
+}
+
+// parseLastlog updates the last login of users from the lastlog records
+// returned by lastlogCmd(uids).  Lastlog retains the most recent login even
+// after wtmp has been rotated away.
+func (h *hostsInfo) parseLastlog(hostName string, uids []int, b bytes.Buffer) error {
+	data := b.Bytes()
+	if len(data) != len(uids)*lastlogSize {
+		return fmt.Errorf("expected %d lastlog bytes, got %d", len(uids)*lastlogSize, len(data))
+	}
+	byUID := make(map[int]utmpRecord)
+	now := time.Now()
+	for n, uid := range uids {
+		rec := data[n*lastlogSize : (n+1)*lastlogSize]
+		secs := binary.LittleEndian.Uint32(rec)
+		// A little endian reading of a big endian timestamp will almost
+		// always be in the future.
+		if int64(secs) > now.Unix() {
+			secs = binary.BigEndian.Uint32(rec)
+		}
+		if secs == 0 {
+			continue
+		}
+		byUID[uid] = utmpRecord{
+			host: cString(rec[lastlogOffHost:]),
+			t:    time.Unix(int64(secs), 0),
+		}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for name, u := range h.users[hostName] {
+		if r, ok := byUID[u.uid]; ok {
+			u.setLast(r.t, r.host)
+			h.users[hostName][name] = u
+		}
+	}
+	return nil
+}
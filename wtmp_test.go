@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeUtmp returns a utmp record in the given byte order.
+func fakeUtmp(order binary.ByteOrder, typ int, user, host string, t time.Time) []byte {
+	rec := make([]byte, utmpSize)
+	order.PutUint16(rec, uint16(typ))
+	copy(rec[utmpOffLine:], "pts/0")
+	copy(rec[utmpOffUser:], user)
+	copy(rec[utmpOffHost:], host)
+	order.PutUint32(rec[utmpOffTime:], uint32(t.Unix()))
+	return rec
+}
+
+func TestParseUtmp(t *testing.T) {
+	t1 := time.Date(2024, 1, 9, 10, 11, 12, 0, time.UTC)
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		var b []byte
+		b = append(b, fakeUtmp(order, 2, "reboot", "5.14.0", t1)...)
+		b = append(b, fakeUtmp(order, utmpUserProcess, "alice", "10.0.0.5", t1)...)
+		// A truncated record
+		b = append(b, 1, 2, 3)
+		records, bad := parseUtmp(b)
+		if bad != 3 {
+			t.Errorf("%v: Unexpected bad bytes: Wanted=3, Got=%d", order, bad)
+		}
+		if len(records) != 2 {
+			t.Fatalf("%v: Unexpected record count: Wanted=2, Got=%d", order, len(records))
+		}
+		r := records[1]
+		if r.typ != utmpUserProcess || r.user != "alice" || r.host != "10.0.0.5" || r.line != "pts/0" || !r.t.Equal(t1) {
+			t.Errorf("%v: Unexpected record: %+v", order, r)
+		}
+	}
+}
+
+func TestParseLoginFiles(t *testing.T) {
+	t1 := time.Date(2024, 1, 9, 10, 11, 12, 0, time.UTC)
+	t2 := time.Date(2024, 2, 1, 8, 0, 0, 0, time.UTC)
+	hosts := newHosts()
+	hosts.users["host1"] = map[string]userInfo{
+		"alice": *newUser("files", 1000, 1000, "x", "Alice", "/bin/bash"),
+		"bob":   *newUser("files", 1001, 1001, "x", "Bob", "/bin/bash"),
+	}
+	var wtmp bytes.Buffer
+	wtmp.Write(fakeUtmp(binary.LittleEndian, utmpUserProcess, "alice", "10.0.0.5", t1))
+	wtmp.Write(fakeUtmp(binary.LittleEndian, 8, "", "", t1.Add(time.Hour)))
+	if bad := hosts.parseWtmp("host1", wtmp); bad != 0 {
+		t.Errorf("Unexpected bad wtmp bytes: %d", bad)
+	}
+
+	// Bob's login has been rotated out of wtmp but remains in lastlog.
+	uids := hosts.lastlogUIDs("host1")
+	if len(uids) != 2 || uids[0] != 1000 || uids[1] != 1001 {
+		t.Fatalf("Unexpected lastlog UIDs: %v", uids)
+	}
+	if cmd := lastlogCmd(uids); !strings.Contains(cmd, "for u in 1000 1001;") {
+		t.Errorf("Unexpected lastlog command: %s", cmd)
+	}
+	lastlog := make([]byte, 2*lastlogSize)
+	binary.LittleEndian.PutUint32(lastlog[lastlogSize:], uint32(t2.Unix()))
+	copy(lastlog[lastlogSize+lastlogOffHost:], "jump.example.com")
+	if err := hosts.parseLastlog("host1", uids, *bytes.NewBuffer(lastlog)); err != nil {
+		t.Fatalf("Unable to parse lastlog: %v", err)
+	}
+	if err := hosts.parseLastlog("host1", uids, *bytes.NewBuffer(lastlog[1:])); err == nil {
+		t.Error("Expected an error for a short lastlog")
+	}
+
+	if hosts.users["host1"]["alice"].failedLogins != -1 {
+		t.Error("Failed logins should be unknown before btmp is parsed")
+	}
+	var btmp bytes.Buffer
+	for n := 0; n < 3; n++ {
+		btmp.Write(fakeUtmp(binary.LittleEndian, 6, "alice", "10.6.6.6", t2))
+	}
+	btmp.Write(fakeUtmp(binary.LittleEndian, 6, "admin", "10.6.6.6", t2))
+	hosts.parseBtmp("host1", btmp)
+
+	alice := hosts.users["host1"]["alice"]
+	if !alice.lastLoginDate.Equal(t1) || alice.lastLoginFrom != "10.0.0.5" || alice.failedLogins != 3 {
+		t.Errorf("Unexpected alice: last=%s from=%s failed=%d", alice.lastLoginDate, alice.lastLoginFrom, alice.failedLogins)
+	}
+	bob := hosts.users["host1"]["bob"]
+	if !bob.lastLoginDate.Equal(t2) || bob.lastLoginFrom != "jump.example.com" || bob.failedLogins != 0 {
+		t.Errorf("Unexpected bob: last=%s from=%s failed=%d", bob.lastLoginDate, bob.lastLoginFrom, bob.failedLogins)
+	}
+}
+
+func TestLastlogBatches(t *testing.T) {
+	var uids []int
+	for uid := 0; uid < 20000; uid++ {
+		uids = append(uids, uid)
+	}
+	batches := lastlogBatches(uids)
+	if len(batches) < 2 {
+		t.Fatalf("Unexpected batches: count=%d", len(batches))
+	}
+	next := 0
+	for n, batch := range batches {
+		if cmd := lastlogCmd(batch); len(cmd) > maxArgBytes+200 {
+			t.Errorf("Batch %d command is too long: %d bytes", n, len(cmd))
+		}
+		for _, uid := range batch {
+			if uid != next {
+				t.Fatalf("Unexpected UID in batch %d: Wanted=%d, Got=%d", n, next, uid)
+			}
+			next++
+		}
+	}
+	if next != len(uids) {
+		t.Errorf("Unexpected UID count: Wanted=%d, Got=%d", len(uids), next)
+	}
+}